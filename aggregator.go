@@ -0,0 +1,441 @@
+package jepl
+
+import (
+	"container/heap"
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// Aggregator is a pluggable per-Call accumulator. Update folds one
+// evaluated argument value (plus its event timestamp, in UnixNano) into
+// the running state; Result returns the current aggregate; Reset clears
+// it so the same Call can be reused across another batch of documents.
+type Aggregator interface {
+	Update(v interface{}, ts int64)
+	Result() interface{}
+	Reset()
+}
+
+// AggregatorFactory builds an Aggregator from a Call's arguments, e.g. to
+// read a percentile or a top(k)/bottom(k)/sample(k) count out of Args.
+type AggregatorFactory func(args []Expr) (Aggregator, error)
+
+// aggregatorRegistry maps a Call's function name to the factory that
+// builds its Aggregator. It is populated by the built-ins below and by
+// RegisterAggregator, so callers can add aggregates without touching
+// eval.go.
+var aggregatorRegistry = make(map[string]AggregatorFactory)
+
+// RegisterAggregator registers factory to build the Aggregator used for
+// Calls named name, replacing any existing registration.
+func RegisterAggregator(name string, factory AggregatorFactory) {
+	aggregatorRegistry[name] = factory
+}
+
+func init() {
+	RegisterAggregator("sum", newSumAggregator)
+	RegisterAggregator("avg", newAvgAggregator)
+	RegisterAggregator("mean", newAvgAggregator)
+	RegisterAggregator("count", newCountAggregator)
+	RegisterAggregator("max", newMaxAggregator)
+	RegisterAggregator("min", newMinAggregator)
+	RegisterAggregator("first", newFirstAggregator)
+	RegisterAggregator("last", newLastAggregator)
+	RegisterAggregator("mode", newModeAggregator)
+	RegisterAggregator("top", newTopBottomAggregator(true))
+	RegisterAggregator("bottom", newTopBottomAggregator(false))
+	RegisterAggregator("percentile", newPercentileAggregator)
+	RegisterAggregator("sample", newSampleAggregator)
+	RegisterAggregator("stddev", newStddevAggregator)
+	RegisterAggregator("distinct_count", newDistinctCountAggregator)
+	RegisterAggregator("topk", newTopKAggregator)
+	RegisterAggregator("len", newLenAggregator)
+}
+
+// Aggregator lazily builds, and caches for its lifetime, the Aggregator
+// registered for c.Name. Repeated calls return the same instance so a
+// Call's state survives across a document batch until reset.
+func (c *Call) Aggregator() (Aggregator, error) {
+	if c.aggregator != nil {
+		return c.aggregator, nil
+	}
+	factory, ok := aggregatorRegistry[c.Name]
+	if !ok {
+		return nil, fmt.Errorf("jepl: no aggregator registered for %s", c.Name)
+	}
+	agg, err := factory(c.Args)
+	if err != nil {
+		return nil, err
+	}
+	c.aggregator = agg
+	return agg, nil
+}
+
+// toFloat coerces the two numeric kinds Eval produces into a float64.
+func toFloat(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case int64:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+// intArg reads the integer literal at position i of args, such as the
+// trailing k in top(field, k) or sample(field, k), defaulting to def.
+func intArg(args []Expr, i int, def int) int {
+	if i < 0 || i >= len(args) {
+		return def
+	}
+	lit, ok := args[i].(*IntegerLiteral)
+	if !ok {
+		return def
+	}
+	return int(lit.Val)
+}
+
+type sumAggregator struct{ sum float64 }
+
+func newSumAggregator(args []Expr) (Aggregator, error) { return &sumAggregator{}, nil }
+func (a *sumAggregator) Update(v interface{}, ts int64) {
+	if f, ok := toFloat(v); ok {
+		a.sum += f
+	}
+}
+func (a *sumAggregator) Result() interface{} { return a.sum }
+func (a *sumAggregator) Reset()              { a.sum = 0 }
+
+type avgAggregator struct {
+	sum   float64
+	count int
+}
+
+func newAvgAggregator(args []Expr) (Aggregator, error) { return &avgAggregator{}, nil }
+func (a *avgAggregator) Update(v interface{}, ts int64) {
+	if f, ok := toFloat(v); ok {
+		a.sum += f
+		a.count++
+	}
+}
+func (a *avgAggregator) Result() interface{} {
+	if a.count == 0 {
+		return float64(0)
+	}
+	return a.sum / float64(a.count)
+}
+func (a *avgAggregator) Reset() { a.sum, a.count = 0, 0 }
+
+type countAggregator struct{ n int }
+
+func newCountAggregator(args []Expr) (Aggregator, error) { return &countAggregator{}, nil }
+func (a *countAggregator) Update(v interface{}, ts int64) { a.n++ }
+func (a *countAggregator) Result() interface{}            { return float64(a.n) }
+func (a *countAggregator) Reset()                         { a.n = 0 }
+
+type maxAggregator struct {
+	val float64
+	has bool
+}
+
+func newMaxAggregator(args []Expr) (Aggregator, error) { return &maxAggregator{}, nil }
+func (a *maxAggregator) Update(v interface{}, ts int64) {
+	f, ok := toFloat(v)
+	if !ok {
+		return
+	}
+	if !a.has || f > a.val {
+		a.val, a.has = f, true
+	}
+}
+func (a *maxAggregator) Result() interface{} { return a.val }
+func (a *maxAggregator) Reset()              { a.val, a.has = 0, false }
+
+type minAggregator struct {
+	val float64
+	has bool
+}
+
+func newMinAggregator(args []Expr) (Aggregator, error) { return &minAggregator{}, nil }
+func (a *minAggregator) Update(v interface{}, ts int64) {
+	f, ok := toFloat(v)
+	if !ok {
+		return
+	}
+	if !a.has || f < a.val {
+		a.val, a.has = f, true
+	}
+}
+func (a *minAggregator) Result() interface{} { return a.val }
+func (a *minAggregator) Reset()              { a.val, a.has = 0, false }
+
+// firstAggregator keeps the value with the smallest ts seen. Every
+// evalFC call stamps ts as time.Now().UnixNano() at evaluation time, so
+// within one batch this is equivalent to arrival order; a caller feeding
+// documents with a real extracted event-time ts gets true first-by-time
+// semantics for free.
+type firstAggregator struct {
+	val interface{}
+	ts  int64
+	has bool
+}
+
+func newFirstAggregator(args []Expr) (Aggregator, error) { return &firstAggregator{}, nil }
+func (a *firstAggregator) Update(v interface{}, ts int64) {
+	if !a.has || ts < a.ts {
+		a.val, a.ts, a.has = v, ts, true
+	}
+}
+func (a *firstAggregator) Result() interface{} { return a.val }
+func (a *firstAggregator) Reset()              { a.val, a.ts, a.has = nil, 0, false }
+
+// lastAggregator keeps the value with the largest ts seen (see
+// firstAggregator for what ts means in practice today).
+type lastAggregator struct {
+	val interface{}
+	ts  int64
+	has bool
+}
+
+func newLastAggregator(args []Expr) (Aggregator, error) { return &lastAggregator{}, nil }
+func (a *lastAggregator) Update(v interface{}, ts int64) {
+	if !a.has || ts > a.ts {
+		a.val, a.ts, a.has = v, ts, true
+	}
+}
+func (a *lastAggregator) Result() interface{} { return a.val }
+func (a *lastAggregator) Reset()              { a.val, a.ts, a.has = nil, 0, false }
+
+// modeAggregator returns the most frequently observed value, breaking
+// ties arbitrarily (Go map iteration order).
+type modeAggregator struct {
+	counts map[interface{}]int
+}
+
+func newModeAggregator(args []Expr) (Aggregator, error) {
+	return &modeAggregator{counts: make(map[interface{}]int)}, nil
+}
+func (a *modeAggregator) Update(v interface{}, ts int64) { a.counts[v]++ }
+func (a *modeAggregator) Result() interface{} {
+	var best interface{}
+	bestN := -1
+	for v, n := range a.counts {
+		if n > bestN {
+			best, bestN = v, n
+		}
+	}
+	return best
+}
+func (a *modeAggregator) Reset() { a.counts = make(map[interface{}]int) }
+
+// topBottomPoint is one observed value kept by a topBottomAggregator.
+type topBottomPoint struct {
+	val float64
+	ts  int64
+}
+
+// topBottomHeap is a container/heap of at most k kept points: a min-heap
+// for top (root is the smallest kept value, evicted first) or a
+// max-heap for bottom (root is the largest kept value, evicted first).
+type topBottomHeap struct {
+	points []topBottomPoint
+	top    bool
+}
+
+func (h topBottomHeap) Len() int { return len(h.points) }
+func (h topBottomHeap) Less(i, j int) bool {
+	if h.top {
+		return h.points[i].val < h.points[j].val
+	}
+	return h.points[i].val > h.points[j].val
+}
+func (h topBottomHeap) Swap(i, j int) { h.points[i], h.points[j] = h.points[j], h.points[i] }
+func (h *topBottomHeap) Push(x interface{}) { h.points = append(h.points, x.(topBottomPoint)) }
+func (h *topBottomHeap) Pop() interface{} {
+	old := h.points
+	n := len(old)
+	p := old[n-1]
+	h.points = old[:n-1]
+	return p
+}
+
+// topBottomAggregator keeps the k largest (top) or smallest (bottom)
+// values seen, using a bounded heap so memory stays O(k) regardless of
+// how many documents are fed.
+type topBottomAggregator struct {
+	k    int
+	heap topBottomHeap
+}
+
+// newTopBottomAggregator returns a factory for top(...)/bottom(...),
+// reading k from the Call's trailing integer literal argument (e.g.
+// top(field, 5)), defaulting to 1 if it's missing or not a literal.
+func newTopBottomAggregator(top bool) AggregatorFactory {
+	return func(args []Expr) (Aggregator, error) {
+		k := intArg(args, len(args)-1, 1)
+		if k < 1 {
+			k = 1
+		}
+		return &topBottomAggregator{k: k, heap: topBottomHeap{top: top}}, nil
+	}
+}
+
+func (a *topBottomAggregator) Update(v interface{}, ts int64) {
+	f, ok := toFloat(v)
+	if !ok {
+		return
+	}
+	p := topBottomPoint{val: f, ts: ts}
+	if a.heap.Len() < a.k {
+		heap.Push(&a.heap, p)
+		return
+	}
+	root := a.heap.points[0]
+	replace := f > root.val
+	if !a.heap.top {
+		replace = f < root.val
+	}
+	if replace {
+		a.heap.points[0] = p
+		heap.Fix(&a.heap, 0)
+	}
+}
+func (a *topBottomAggregator) Result() interface{} {
+	pts := make([]topBottomPoint, len(a.heap.points))
+	copy(pts, a.heap.points)
+	sort.Slice(pts, func(i, j int) bool {
+		if a.heap.top {
+			return pts[i].val > pts[j].val
+		}
+		return pts[i].val < pts[j].val
+	})
+	out := make([]interface{}, len(pts))
+	for i, p := range pts {
+		out[i] = p.val
+	}
+	return out
+}
+func (a *topBottomAggregator) Reset() { a.heap.points = nil }
+
+// PercentileCompression is the t-digest compression factor (bigger means
+// more centroids, so better accuracy at the cost of more memory) newly
+// built percentileAggregators use. Callers that need tighter error
+// bounds than the default 100 can raise it before evaluating a query;
+// existing Calls already holding a digest are unaffected until Reset.
+var PercentileCompression = 100.0
+
+// percentileAggregator answers percentile(field, p) off the existing
+// t-digest sketch (tdigest.go) rather than a second quantile algorithm,
+// since t-digest already gives the same streaming, bounded-memory
+// approximation a P² estimator would.
+type percentileAggregator struct {
+	digest *tDigest
+	p      float64
+}
+
+func newPercentileAggregator(args []Expr) (Aggregator, error) {
+	if len(args) < 2 {
+		return nil, fmt.Errorf("jepl: percentile requires a percentile argument")
+	}
+	p := 0.0
+	switch lit := args[1].(type) {
+	case *IntegerLiteral:
+		p = float64(lit.Val)
+	case *NumberLiteral:
+		p = lit.Val
+	}
+	return &percentileAggregator{digest: newTDigest(PercentileCompression), p: p}, nil
+}
+func (a *percentileAggregator) Update(v interface{}, ts int64) {
+	if f, ok := toFloat(v); ok {
+		a.digest.Add(f)
+	}
+}
+func (a *percentileAggregator) Result() interface{} { return a.digest.Quantile(a.p / 100) }
+func (a *percentileAggregator) Reset()               { a.digest = newTDigest(PercentileCompression) }
+
+// sampleAggregator implements reservoir sampling (Algorithm R) to keep
+// an unbiased sample of k values out of an unbounded stream.
+type sampleAggregator struct {
+	k       int
+	seen    int
+	samples []interface{}
+	rng     *rand.Rand
+}
+
+func newSampleAggregator(args []Expr) (Aggregator, error) {
+	k := intArg(args, 1, 1)
+	if k < 1 {
+		k = 1
+	}
+	return &sampleAggregator{k: k, rng: rand.New(rand.NewSource(time.Now().UnixNano()))}, nil
+}
+func (a *sampleAggregator) Update(v interface{}, ts int64) {
+	a.seen++
+	if len(a.samples) < a.k {
+		a.samples = append(a.samples, v)
+		return
+	}
+	if j := a.rng.Intn(a.seen); j < a.k {
+		a.samples[j] = v
+	}
+}
+func (a *sampleAggregator) Result() interface{} { return a.samples }
+func (a *sampleAggregator) Reset() {
+	a.seen = 0
+	a.samples = nil
+}
+
+type stddevAggregator struct{ w welford }
+
+func newStddevAggregator(args []Expr) (Aggregator, error) { return &stddevAggregator{}, nil }
+func (a *stddevAggregator) Update(v interface{}, ts int64) {
+	if f, ok := toFloat(v); ok {
+		a.w.Add(f)
+	}
+}
+func (a *stddevAggregator) Result() interface{} { return a.w.StdDev() }
+func (a *stddevAggregator) Reset()               { a.w = welford{} }
+
+type distinctCountAggregator struct{ hll *hyperLogLog }
+
+func newDistinctCountAggregator(args []Expr) (Aggregator, error) {
+	return &distinctCountAggregator{hll: newHyperLogLog()}, nil
+}
+func (a *distinctCountAggregator) Update(v interface{}, ts int64) { a.hll.Add(v) }
+func (a *distinctCountAggregator) Result() interface{}            { return float64(a.hll.Count()) }
+func (a *distinctCountAggregator) Reset()                         { a.hll = newHyperLogLog() }
+
+// lenAggregator reports the element count of the most recently observed
+// list-valued argument, e.g. Len(tags) where tags is a *ListLiteral or a
+// list-valued field. Non-list values report a length of 0.
+type lenAggregator struct{ n int }
+
+func newLenAggregator(args []Expr) (Aggregator, error) { return &lenAggregator{}, nil }
+func (a *lenAggregator) Update(v interface{}, ts int64) {
+	if s, ok := v.([]interface{}); ok {
+		a.n = len(s)
+	} else {
+		a.n = 0
+	}
+}
+func (a *lenAggregator) Result() interface{} { return float64(a.n) }
+func (a *lenAggregator) Reset()              { a.n = 0 }
+
+type topKAggregator struct {
+	sketch *topKSketch
+	k      int
+}
+
+func newTopKAggregator(args []Expr) (Aggregator, error) {
+	k := intArg(args, 1, 1)
+	if k < 1 {
+		k = 1
+	}
+	return &topKAggregator{sketch: newTopKSketch(k), k: k}, nil
+}
+func (a *topKAggregator) Update(v interface{}, ts int64) { a.sketch.Add(fmt.Sprintf("%v", v)) }
+func (a *topKAggregator) Result() interface{}            { return a.sketch.Top(a.k) }
+func (a *topKAggregator) Reset()                         { a.sketch = newTopKSketch(a.k) }
@@ -0,0 +1,84 @@
+package jepl_test
+
+import (
+	"github.com/chenyoufu/jepl"
+	"testing"
+)
+
+// feedCall builds a *Call for name with args, drives its Aggregator
+// with 100 samples (0..99), and returns the Call plus its Aggregator.
+func feedCall(t *testing.T, name string, args []jepl.Expr) (*jepl.Call, jepl.Aggregator) {
+	t.Helper()
+	call := &jepl.Call{Name: name, Args: args}
+	agg, err := call.Aggregator()
+	if err != nil {
+		t.Fatalf("%s: Aggregator(): %s", name, err)
+	}
+	for i := 0; i < 100; i++ {
+		agg.Update(float64(i), int64(i))
+	}
+	return call, agg
+}
+
+// cloneAggregator clones call via CloneExpr and returns the clone's
+// own Aggregator.
+func cloneAggregator(t *testing.T, call *jepl.Call) jepl.Aggregator {
+	t.Helper()
+	clone, ok := jepl.CloneExpr(call).(*jepl.Call)
+	if !ok {
+		t.Fatalf("CloneExpr(%s) did not return a *Call", call.Name)
+	}
+	agg, err := clone.Aggregator()
+	if err != nil {
+		t.Fatalf("%s: clone Aggregator(): %s", call.Name, err)
+	}
+	return agg
+}
+
+// Ensure percentile's t-digest, distinct_count's HyperLogLog, and
+// topk's Space-Saving sketch all start fresh and independent of the
+// original after Clone() — each GROUP BY bucket FlatStatByGroup
+// produces must accumulate its own samples, not the original Call's.
+func TestSketchAggregatorsSurviveClone(t *testing.T) {
+	field := &jepl.VarRef{Val: "x", Segments: []string{"x"}}
+
+	t.Run("percentile", func(t *testing.T) {
+		call, agg := feedCall(t, "percentile", []jepl.Expr{field, &jepl.NumberLiteral{Val: 50}})
+		if r := agg.Result().(float64); r == 0 {
+			t.Fatalf("expected a non-zero median over 0..99, got %v", r)
+		}
+		if r := cloneAggregator(t, call).Result().(float64); r != 0 {
+			t.Errorf("clone's t-digest should start empty (median 0), got %v", r)
+		}
+	})
+
+	t.Run("distinct_count", func(t *testing.T) {
+		call, agg := feedCall(t, "distinct_count", []jepl.Expr{field})
+		if r := agg.Result().(float64); r == 0 {
+			t.Fatalf("expected a non-zero cardinality over 100 distinct values, got %v", r)
+		}
+		if r := cloneAggregator(t, call).Result().(float64); r != 0 {
+			t.Errorf("clone's HyperLogLog should start empty (count 0), got %v", r)
+		}
+	})
+
+	t.Run("topk", func(t *testing.T) {
+		call, agg := feedCall(t, "topk", []jepl.Expr{field, &jepl.IntegerLiteral{Val: 3}})
+		if r := agg.Result().([]string); len(r) == 0 {
+			t.Fatalf("expected at least one tracked key, got none")
+		}
+		if r := cloneAggregator(t, call).Result().([]string); len(r) != 0 {
+			t.Errorf("clone's topk sketch should start empty, got %v", r)
+		}
+	})
+
+	t.Run("stddev", func(t *testing.T) {
+		call, agg := feedCall(t, "stddev", []jepl.Expr{field})
+		if r := agg.Result().(float64); r == 0 {
+			t.Fatalf("expected a non-zero stddev over 0..99, got %v", r)
+		}
+		if r := cloneAggregator(t, call).Result().(float64); r != 0 {
+			t.Errorf("clone's welford accumulator should start empty (stddev 0), got %v", r)
+		}
+	})
+}
@@ -5,7 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/bitly/go-simplejson"
+	"math"
 	"reflect"
 	"regexp"
 	"regexp/syntax"
@@ -89,13 +89,19 @@ func (Statements) node() {}
 
 func (*SelectStatement) node() {}
 
-func (*BinaryExpr) node()     {}
-func (*BooleanLiteral) node() {}
-func (*Call) node()           {}
-func (*IntegerLiteral) node() {}
+func (*BinaryExpr) node()      {}
+func (*BooleanLiteral) node()  {}
+func (*BoundParameter) node()  {}
+func (*Call) node()            {}
+func (*CastExpr) node()        {}
+func (*ConditionalExpr) node() {}
+func (*IndexExpr) node()      {}
+func (*IntegerLiteral) node()  {}
 func (*Field) node()          {}
 func (Fields) node()          {}
 func (*Measurement) node()    {}
+func (*SliceExpr) node()      {}
+func (*SubQuery) node()       {}
 func (Measurements) node()    {}
 func (*nilLiteral) node()     {}
 func (*NumberLiteral) node()  {}
@@ -140,15 +146,20 @@ type Expr interface {
 	expr()
 }
 
-func (*BinaryExpr) expr()     {}
-func (*BooleanLiteral) expr() {}
-func (*Call) expr()           {}
-func (*IntegerLiteral) expr() {}
+func (*BinaryExpr) expr()      {}
+func (*BooleanLiteral) expr()  {}
+func (*BoundParameter) expr()  {}
+func (*Call) expr()            {}
+func (*CastExpr) expr()        {}
+func (*ConditionalExpr) expr() {}
+func (*IndexExpr) expr()      {}
+func (*IntegerLiteral) expr()  {}
 func (*nilLiteral) expr()     {}
 func (*NumberLiteral) expr()  {}
 func (*ParenExpr) expr()      {}
 func (*RegexLiteral) expr()   {}
 func (*ListLiteral) expr()    {}
+func (*SliceExpr) expr()      {}
 func (*StringLiteral) expr()  {}
 func (*VarRef) expr()         {}
 func (*Wildcard) expr()       {}
@@ -174,6 +185,7 @@ type Source interface {
 }
 
 func (*Measurement) source() {}
+func (*SubQuery) source()    {}
 
 // Sources represents a list of sources.
 type Sources []Source
@@ -185,6 +197,8 @@ func (a Sources) Names() []string {
 		switch s := s.(type) {
 		case *Measurement:
 			names = append(names, s.Database)
+		case *SubQuery:
+			names = append(names, s.Alias)
 		}
 	}
 	return names
@@ -221,6 +235,23 @@ type SelectStatement struct {
 
 	// Removes duplicate rows from raw queries.
 	Dedupe bool
+
+	// GROUP BY dimensions: bare tag idents and/or a time(...) window.
+	Dimensions Dimensions
+
+	// Window, if non-nil, buckets evaluation into tumbling or sliding
+	// GROUP BY time(...) windows (see WindowSpec and NewWindowedEvaluator).
+	Window *WindowSpec
+
+	// TimeField resolves the event timestamp used to assign a document to
+	// a window (e.g. a VarRef for "_source.@timestamp"). Only meaningful
+	// when Window is set.
+	TimeField Expr
+
+	// Having filters aggregated groups after EvalMetric, evaluated
+	// against a synthetic doc built from the field aliases (see
+	// EvalHaving).
+	Having Expr
 }
 
 // matchExactRegex matches regexes that have the following form: /^foo$/. It
@@ -269,8 +300,16 @@ func matchExactRegex(v string) (string, bool) {
 }
 
 // ColumnNames will walk all fields and functions and return the appropriate field names for the select statement
-// while maintaining order of the field names
+// while maintaining order of the field names. A GROUP BY statement's
+// dimension keys are emitted first, in Dimensions order, ahead of the
+// field/aggregate columns, matching the row shape Evaluator/
+// FlatStatByGroup produce (one row per group, keyed by its dimensions).
 func (s *SelectStatement) ColumnNames() []string {
+	var groupNames []string
+	for _, d := range s.Dimensions {
+		groupNames = append(groupNames, d.String())
+	}
+
 	// First walk each field to determine the number of columns.
 	columnFields := Fields{}
 	for _, field := range s.Fields {
@@ -312,7 +351,7 @@ func (s *SelectStatement) ColumnNames() []string {
 		names[name]++
 		columnNames[i] = name
 	}
-	return columnNames
+	return append(groupNames, columnNames...)
 }
 
 // String returns a string representation of the select statement.
@@ -329,6 +368,10 @@ func (s *SelectStatement) String() string {
 		_, _ = buf.WriteString(" WHERE ")
 		_, _ = buf.WriteString(s.Condition.String())
 	}
+	if len(s.Dimensions) > 0 {
+		_, _ = buf.WriteString(" GROUP BY ")
+		_, _ = buf.WriteString(s.Dimensions.String())
+	}
 	return buf.String()
 }
 
@@ -341,9 +384,23 @@ func (s *SelectStatement) validate() error {
 		return err
 	}
 
+	if err := s.validateCondition(); err != nil {
+		return err
+	}
+
 	return nil
 }
 
+// validateCondition reports an error if the WHERE clause applies an
+// ordering or arithmetic operator to a string literal operand (e.g.
+// `uid > 'xxx'`); evalBinaryExpr has no sane behavior for that and would
+// otherwise silently fail the condition at eval time instead of at parse
+// time.
+func (s *SelectStatement) validateCondition() error {
+	_, err := checkFilterType(s.Condition)
+	return err
+}
+
 func (s *SelectStatement) validateFields() error {
 	for _, f := range s.Fields {
 		var c validateField
@@ -366,10 +423,10 @@ func (s *SelectStatement) validateFields() error {
 }
 
 // validSelectWithAggregate determines if a SELECT statement has the correct
-// combination of aggregate functions combined with selected fields and tags
-// Currently we don't have support for all aggregates, but aggregates that
-// can be combined with fields/tags are:
-//  TOP, BOTTOM, MAX, MIN, FIRST, LAST
+// combination of aggregate functions combined with selected fields and tags.
+// Only selector functions — ones that pick one value out of the group
+// rather than reducing over all of it — may be combined with fields/tags:
+//  TOP, BOTTOM, MAX, MIN, FIRST, LAST, PERCENTILE, SAMPLE
 func (s *SelectStatement) validSelectWithAggregate() error {
 	calls := map[string]struct{}{}
 	numAggregates := 0
@@ -416,8 +473,18 @@ func (s *SelectStatement) validateAggregates() error {
 			if err := s.validSelectWithAggregate(); err != nil {
 				return err
 			}
-			if len(expr.Args) != 1 {
-				return fmt.Errorf("invalid number of arguments for %s, expected 1, got %d", expr.Name, len(expr.Args))
+			wantArgs := 1
+			switch expr.Name {
+			case "percentile", "topk":
+				wantArgs = 2
+			case "top", "bottom", "sample":
+				// k is optional; the Aggregator defaults it to 1.
+				if len(expr.Args) == 2 {
+					wantArgs = 2
+				}
+			}
+			if len(expr.Args) != wantArgs {
+				return fmt.Errorf("invalid number of arguments for %s, expected %d, got %d", expr.Name, wantArgs, len(expr.Args))
 			}
 			if expr.Name == "count" {
 				if _, ok := expr.Args[0].(*VarRef); !ok {
@@ -459,6 +526,49 @@ func (s *SelectStatement) NamesInSelect() []string {
 	return a
 }
 
+// NamesInParameters returns the names of every "$param" BoundParameter
+// referenced in the select and where clauses, so a caller can check
+// what BindParameters requires before calling it.
+func (s *SelectStatement) NamesInParameters() []string {
+	var a []string
+	if s.Condition != nil {
+		a = append(a, namesInParameters(s.Condition)...)
+	}
+	for _, f := range s.Fields {
+		a = append(a, namesInParameters(f.Expr)...)
+	}
+	return a
+}
+
+// namesInParameters is NamesInParameters' recursive AST walk, modeled on
+// walkNames below but looking for *BoundParameter instead of *VarRef.
+func namesInParameters(exp Expr) []string {
+	switch expr := exp.(type) {
+	case *BoundParameter:
+		return []string{expr.Name}
+	case *Call:
+		var a []string
+		for _, arg := range expr.Args {
+			a = append(a, namesInParameters(arg)...)
+		}
+		return a
+	case *BinaryExpr:
+		var a []string
+		a = append(a, namesInParameters(expr.LHS)...)
+		a = append(a, namesInParameters(expr.RHS)...)
+		return a
+	case *ParenExpr:
+		return namesInParameters(expr.Expr)
+	case *ConditionalExpr:
+		var a []string
+		a = append(a, namesInParameters(expr.Cond)...)
+		a = append(a, namesInParameters(expr.TrueExpr)...)
+		a = append(a, namesInParameters(expr.FalseExpr)...)
+		return a
+	}
+	return nil
+}
+
 // walkNames will walk the Expr and return the database fields
 func walkNames(exp Expr) []string {
 	switch expr := exp.(type) {
@@ -520,44 +630,6 @@ func (s *SelectStatement) FunctionCalls() []*Call {
 	return a
 }
 
-// FunctionCalls returns the Call objects from the query
-func (s *SelectStatement) EvalFunctionCalls(m map[string]interface{}) {
-	for _, f := range s.Fields {
-		evalFC(f.Expr, m)
-	}
-}
-
-func evalFC(expr Expr, m map[string]interface{}) {
-	switch expr := expr.(type) {
-	case *Call:
-		switch expr.Name {
-		case "sum", "avg":
-			switch res := Eval(expr.Args[0], m).(type) {
-			case int64:
-				expr.result += float64(res)
-			case float64:
-				expr.result += res
-			}
-		}
-	case *BinaryExpr:
-		evalFC(expr.LHS, m)
-		evalFC(expr.RHS, m)
-	}
-}
-
-type Point struct {
-	Metric float64
-	TS     int64
-}
-
-func (s *SelectStatement) EvalMetric() []Point {
-	points := []Point{}
-	for _, f := range s.Fields {
-		points = append(points, Point{Eval(f.Expr, nil).(float64), time.Now().Unix()})
-	}
-	return points
-}
-
 // FunctionCallsByPosition returns the Call objects from the query in the order they appear in the select statement
 func (s *SelectStatement) FunctionCallsByPosition() [][]*Call {
 	var a [][]*Call
@@ -729,6 +801,24 @@ func (r *VarRef) String() string {
 	return buf.String()
 }
 
+// BoundParameter represents a "$name" parameter placeholder, substituted
+// by SelectStatement.BindParameters at evaluation time. This is a
+// separate mechanism from the "?"/":name" convention Prepare/Exec use
+// (see paramName in prepared.go), which reuses VarRef so it can piggyback
+// on identifier scanning; BoundParameter is its own node for the
+// dedicated BOUNDPARAM token reserved in token.go. This tree has no
+// scanner/parser to produce one from source text yet, so today a
+// BoundParameter can only be constructed by hand when building an AST
+// programmatically.
+type BoundParameter struct {
+	Name string
+}
+
+// String returns a string representation of the bound parameter.
+func (p *BoundParameter) String() string {
+	return "$" + p.Name
+}
+
 // VarRefs represents a slice of VarRef types.
 type VarRefs []VarRef
 
@@ -747,9 +837,33 @@ func (a VarRefs) Strings() []string {
 
 // Call represents a function call.
 type Call struct {
-	Name   string
-	Args   []Expr  // must hava not funcCall expr
-	result float64 // must be float64
+	Name  string
+	Args  []Expr // must hava not funcCall expr
+	Count int
+
+	// First records whether the call's parentheses were seen by the
+	// parser, distinguishing a parsed `name()` call (Args may be empty)
+	// from a zero-value Call that was never actually parsed.
+	First bool
+
+	// aggregator is the registered Aggregator for Name, lazily built by
+	// Aggregator() and reused for this Call's lifetime. Clone gives every
+	// GROUP BY bucket a fresh *Call, so this starts nil per bucket.
+	aggregator Aggregator
+}
+
+// ConditionalExpr represents a ternary `Cond ? TrueExpr : FalseExpr`
+// expression, e.g. `temp > 80 ? "hot" : "cold"`. Chained ternaries
+// (`a ? b : c ? d : e`) nest FalseExpr as another *ConditionalExpr.
+type ConditionalExpr struct {
+	Cond      Expr
+	TrueExpr  Expr
+	FalseExpr Expr
+}
+
+// String returns a string representation of the conditional expression.
+func (c *ConditionalExpr) String() string {
+	return fmt.Sprintf("%s ? %s : %s", c.Cond.String(), c.TrueExpr.String(), c.FalseExpr.String())
 }
 
 // String returns a string representation of the call.
@@ -876,6 +990,50 @@ func (s *ListLiteral) String() string {
 	return buf.String()
 }
 
+// IndexExpr represents a single-element index into a list, e.g. `xs[0]`.
+type IndexExpr struct {
+	Expr  Expr
+	Index Expr
+}
+
+// String returns a string representation of the index expression.
+func (e *IndexExpr) String() string {
+	return fmt.Sprintf("%s[%s]", e.Expr.String(), e.Index.String())
+}
+
+// SliceExpr represents a half-open slice of a list, e.g. `xs[1:3]`. Low
+// and High are nil when omitted (`xs[:3]`, `xs[1:]`, `xs[:]`).
+type SliceExpr struct {
+	Expr Expr
+	Low  Expr
+	High Expr
+}
+
+// String returns a string representation of the slice expression.
+func (e *SliceExpr) String() string {
+	var low, high string
+	if e.Low != nil {
+		low = e.Low.String()
+	}
+	if e.High != nil {
+		high = e.High.String()
+	}
+	return fmt.Sprintf("%s[%s:%s]", e.Expr.String(), low, high)
+}
+
+// CastExpr represents a typed cast `expr::type`, e.g. `uid::integer`,
+// using the DOUBLECOLON token. Type is one of "integer", "float",
+// "string", "boolean"; castValue (eval.go) does the actual coercion.
+type CastExpr struct {
+	Expr Expr
+	Type string
+}
+
+// String returns a string representation of the cast expression.
+func (e *CastExpr) String() string {
+	return fmt.Sprintf("%s::%s", e.Expr.String(), e.Type)
+}
+
 // StringLiteral represents a string literal.
 type StringLiteral struct {
 	Val string
@@ -956,6 +1114,31 @@ func (v *binaryExprValidator) Visit(n Node) Visitor {
 	return v
 }
 
+// validateField walks a SELECT field's expression looking for a binary
+// operator that isn't one of the arithmetic ones; SELECT fields may only
+// combine sub-expressions with +, -, *, /, or %.
+type validateField struct {
+	foundInvalid bool
+	badToken     Token
+}
+
+func (v *validateField) Visit(n Node) Visitor {
+	if v.foundInvalid {
+		return nil
+	}
+
+	if expr, ok := n.(*BinaryExpr); ok {
+		switch expr.Op {
+		case ADD, SUB, MUL, DIV, MOD:
+		default:
+			v.foundInvalid = true
+			v.badToken = expr.Op
+			return nil
+		}
+	}
+	return v
+}
+
 // BinaryExprName returns the name of a binary expression by concatenating
 // the variables in the binary expression with underscores.
 func BinaryExprName(expr *BinaryExpr) string {
@@ -1000,20 +1183,6 @@ func (r *RegexLiteral) String() string {
 	return ""
 }
 
-// CloneRegexLiteral returns a clone of the RegexLiteral.
-func CloneRegexLiteral(r *RegexLiteral) *RegexLiteral {
-	if r == nil {
-		return nil
-	}
-
-	clone := &RegexLiteral{}
-	if r.Val != nil {
-		clone.Val = regexp.MustCompile(r.Val.String())
-	}
-
-	return clone
-}
-
 // Wildcard represents a wild card expression.
 type Wildcard struct {
 	Type Token
@@ -1086,6 +1255,14 @@ func Walk(v Visitor, node Node) {
 			Walk(v, expr)
 		}
 
+	case *CastExpr:
+		Walk(v, n.Expr)
+
+	case *ConditionalExpr:
+		Walk(v, n.Cond)
+		Walk(v, n.TrueExpr)
+		Walk(v, n.FalseExpr)
+
 	case *Field:
 		Walk(v, n.Expr)
 
@@ -1094,6 +1271,15 @@ func Walk(v Visitor, node Node) {
 			Walk(v, c)
 		}
 
+	case *IndexExpr:
+		Walk(v, n.Expr)
+		Walk(v, n.Index)
+
+	case *SliceExpr:
+		Walk(v, n.Expr)
+		Walk(v, n.Low)
+		Walk(v, n.High)
+
 	case *ParenExpr:
 		Walk(v, n.Expr)
 
@@ -1130,21 +1316,38 @@ type Rewriter interface {
 	Rewrite(Node) Node
 }
 
-// Eval evaluates expr against a map.
-func Eval(expr Expr, m map[string]interface{}) interface{} {
+// EvalValuer evaluates expr, resolving every *VarRef (and any *Call
+// valuer has an entry for, e.g. "now()") through valuer instead of a
+// fixed map. This lets callers plug in a custom data source — a
+// struct, a DB row, a composed MultiValuer — by implementing Valuer,
+// without Eval re-serializing a map to JSON on every access the way it
+// used to via json.Marshal + simplejson.NewJson.
+func EvalValuer(expr Expr, valuer Valuer) interface{} {
 	if expr == nil {
 		return nil
 	}
 
 	switch expr := expr.(type) {
 	case *Call:
-		res := expr.result
-		expr.result = 0
-		return res
+		// Plain Valuer-backed evaluation (no aggregation/windowing) only
+		// supports Calls the Valuer itself resolves, e.g. "now()" via
+		// NowValuer; anything else has no fixed value here.
+		v, _ := valuer.Value(expr.String())
+		return v
 	case *BinaryExpr:
-		return evalBinaryExpr(expr, m)
+		return evalBinaryExprValuer(expr, valuer)
 	case *BooleanLiteral:
 		return expr.Val
+	case *CastExpr:
+		return castValue(EvalValuer(expr.Expr, valuer), expr.Type)
+	case *ConditionalExpr:
+		// Short-circuit: only the selected branch is evaluated.
+		if b, _ := EvalValuer(expr.Cond, valuer).(bool); b {
+			return EvalValuer(expr.TrueExpr, valuer)
+		}
+		return EvalValuer(expr.FalseExpr, valuer)
+	case *IndexExpr:
+		return evalIndex(EvalValuer(expr.Expr, valuer), EvalValuer(expr.Index, valuer))
 	case *ListLiteral:
 		return expr.Vals
 	case *IntegerLiteral:
@@ -1152,43 +1355,47 @@ func Eval(expr Expr, m map[string]interface{}) interface{} {
 	case *NumberLiteral:
 		return expr.Val
 	case *ParenExpr:
-		return Eval(expr.Expr, m)
+		return EvalValuer(expr.Expr, valuer)
 	case *RegexLiteral:
 		return expr.Val
+	case *SliceExpr:
+		var low, high interface{}
+		if expr.Low != nil {
+			low = EvalValuer(expr.Low, valuer)
+		}
+		if expr.High != nil {
+			high = EvalValuer(expr.High, valuer)
+		}
+		return evalSlice(EvalValuer(expr.Expr, valuer), low, high)
 	case *StringLiteral:
 		return expr.Val
 	case *VarRef:
-		ms, _ := json.Marshal(m)
-		js, _ := simplejson.NewJson(ms)
-		switch v := js.GetPath(expr.Segments...).Interface().(type) {
-		case json.Number:
-			if n, err := v.Int64(); err != nil {
-				if f, err := v.Float64(); err != nil {
-					fmt.Println("json Number eval Error")
-				} else {
-					return f
-				}
-			} else {
-				return n
-			}
-		default:
-			return v
-		}
+		v, _ := valuer.Value(expr.Val)
+		return v
 	default:
 		return nil
 	}
-	return nil
 }
 
-func evalBinaryExpr(expr *BinaryExpr, m map[string]interface{}) interface{} {
-	lhs := Eval(expr.LHS, m)
-	rhs := Eval(expr.RHS, m)
+// evalBinaryExprValuer is evalBinaryExpr's Valuer-backed counterpart,
+// used by EvalValuer instead of the *string-based Eval in eval.go.
+func evalBinaryExprValuer(expr *BinaryExpr, valuer Valuer) interface{} {
+	lhs := EvalValuer(expr.LHS, valuer)
+	rhs := EvalValuer(expr.RHS, valuer)
+	return applyBinaryOp(expr.Op, lhs, rhs)
+}
 
+// applyBinaryOp applies op to two already-evaluated operands. It is
+// shared by evalBinaryExprValuer (the Valuer-backed tree-walking path)
+// and Program.Run's OpBinary instruction (the compiled path), so
+// compiling an expression and walking it directly always agree on
+// operator semantics.
+func applyBinaryOp(op Token, lhs, rhs interface{}) interface{} {
 	// Evaluate if both sides are simple types.
 	switch lhs := lhs.(type) {
 	case bool:
 		rhs, ok := rhs.(bool)
-		switch expr.Op {
+		switch op {
 		case AND:
 			return ok && (lhs && rhs)
 		case OR:
@@ -1208,7 +1415,7 @@ func evalBinaryExpr(expr *BinaryExpr, m map[string]interface{}) interface{} {
 			}
 		}
 
-		switch expr.Op {
+		switch op {
 		case IN:
 			return in_array(lhs, rhs)
 		case NI:
@@ -1243,10 +1450,18 @@ func evalBinaryExpr(expr *BinaryExpr, m map[string]interface{}) interface{} {
 		case DIV:
 			if !ok {
 				return nil
-			} else if rhs == 0 {
-				return float64(0)
+			} else if rhsf == 0 {
+				// NaN, not float64(0), so a divide-by-zero is
+				// distinguishable from a genuine zero result instead of
+				// silently corrupting a downstream sum/avg.
+				return math.NaN()
 			}
 			return lhs / rhsf
+		case MOD:
+			if !ok {
+				return nil
+			}
+			return math.Mod(lhs, rhsf)
 		}
 	case int64:
 		// Try as a float64 to see if a float cast is required.
@@ -1254,7 +1469,7 @@ func evalBinaryExpr(expr *BinaryExpr, m map[string]interface{}) interface{} {
 		if ok {
 			lhs := float64(lhs)
 			rhs := rhsf
-			switch expr.Op {
+			switch op {
 			case EQ:
 				return lhs == rhs
 			case NEQ:
@@ -1275,13 +1490,15 @@ func evalBinaryExpr(expr *BinaryExpr, m map[string]interface{}) interface{} {
 				return lhs * rhs
 			case DIV:
 				if rhs == 0 {
-					return float64(0)
+					return math.NaN()
 				}
 				return lhs / rhs
+			case MOD:
+				return math.Mod(lhs, rhs)
 			}
 		} else {
 			rhsi, ok := rhs.(int64)
-			switch expr.Op {
+			switch op {
 			case IN:
 				return in_array(lhs, rhs)
 			case NI:
@@ -1316,14 +1533,24 @@ func evalBinaryExpr(expr *BinaryExpr, m map[string]interface{}) interface{} {
 			case DIV:
 				if !ok {
 					return nil
-				} else if rhs == 0 {
-					return float64(0)
+				} else if rhsi == 0 {
+					return math.NaN()
 				}
+				// int64/int64 division truncates toward zero, same as Go's
+				// native / operator; use float64 operands above for exact
+				// division.
 				return lhs / rhsi
+			case MOD:
+				if !ok {
+					return nil
+				} else if rhsi == 0 {
+					return math.NaN()
+				}
+				return lhs % rhsi
 			}
 		}
 	case string:
-		switch expr.Op {
+		switch op {
 		case IN:
 			return in_array(lhs, rhs)
 		case NI:
@@ -1341,6 +1568,15 @@ func evalBinaryExpr(expr *BinaryExpr, m map[string]interface{}) interface{} {
 			rhs, ok := rhs.(*regexp.Regexp)
 			return ok && !rhs.MatchString(lhs)
 		}
+	case []interface{}:
+		// ANY/ALL (`ANY(sensors, temp > 80)`) are deliberately not
+		// implemented yet: evaluating a predicate per list element needs a
+		// way to bind that element as a name the predicate's VarRefs can
+		// resolve against, and JEPL's AST has no per-element scoping/lambda
+		// node to carry that binding through Eval/EvalValuer.
+		if op == CONTAINS {
+			return in_array(rhs, lhs)
+		}
 	}
 	return nil
 }
@@ -1353,7 +1589,7 @@ func in_array(val interface{}, array interface{}) (exists bool) {
 		s := reflect.ValueOf(array)
 
 		for i := 0; i < s.Len(); i++ {
-			if reflect.DeepEqual(val, s.Index(i).Interface()) == true {
+			if valuesEqual(val, s.Index(i).Interface()) {
 				exists = true
 				return
 			}
@@ -1362,11 +1598,67 @@ func in_array(val interface{}, array interface{}) (exists bool) {
 	return
 }
 
-// EvalBool evaluates expr and returns true if result is a boolean true.
-// Otherwise returns false.
-func EvalBool(expr Expr, m map[string]interface{}) bool {
-	v, _ := Eval(expr, m).(bool)
-	return v
+// evalIndex returns element i of list, or nil if list isn't a slice or i
+// is out of range. i is coerced through toFloat since an IndexExpr's
+// Index commonly evaluates to an IntegerLiteral's int64.
+func evalIndex(list interface{}, i interface{}) interface{} {
+	s, ok := list.([]interface{})
+	if !ok {
+		return nil
+	}
+	idxf, ok := toFloat(i)
+	if !ok {
+		return nil
+	}
+	idx := int(idxf)
+	if idx < 0 || idx >= len(s) {
+		return nil
+	}
+	return s[idx]
+}
+
+// evalSlice returns the half-open slice list[low:high], clamped to
+// list's bounds. A nil low defaults to 0; a nil high defaults to
+// len(list).
+func evalSlice(list interface{}, low, high interface{}) interface{} {
+	s, ok := list.([]interface{})
+	if !ok {
+		return nil
+	}
+	lo, hi := 0, len(s)
+	if low != nil {
+		if f, ok := toFloat(low); ok {
+			lo = int(f)
+		}
+	}
+	if high != nil {
+		if f, ok := toFloat(high); ok {
+			hi = int(f)
+		}
+	}
+	if lo < 0 {
+		lo = 0
+	}
+	if hi > len(s) {
+		hi = len(s)
+	}
+	if lo > hi {
+		return []interface{}{}
+	}
+	return s[lo:hi]
+}
+
+// valuesEqual compares val against an array element, normalizing int64
+// and float64 first since JSON decoding and JEPL's own literals produce
+// a mix of both for what a rule author writes as one numeric type (e.g.
+// `x IN [1, 2, 3]` against a float64 field, or the reverse).
+func valuesEqual(val, elem interface{}) bool {
+	valf, valIsNum := toFloat(val)
+	elemf, elemIsNum := toFloat(elem)
+	if valIsNum && elemIsNum {
+		return valf == elemf
+	}
+	return reflect.DeepEqual(val, elem)
 }
 
 // Valuer is the interface that wraps the Value() method.
@@ -1389,6 +1681,67 @@ func (v *NowValuer) Value(key string) (interface{}, bool) {
 	return nil, false
 }
 
+// MapValuer implements Valuer by walking a VarRef's dotted path
+// directly over nested map[string]interface{}/[]interface{} values,
+// converting a json.Number leaf once. This replaces the previous
+// json.Marshal + simplejson.NewJson round trip, which re-serialized
+// the whole map on every single VarRef access.
+type MapValuer map[string]interface{}
+
+// Value walks key's dot-separated path over v.
+func (v MapValuer) Value(key string) (interface{}, bool) {
+	var cur interface{} = map[string]interface{}(v)
+	for _, seg := range strings.Split(key, ".") {
+		switch c := cur.(type) {
+		case map[string]interface{}:
+			next, ok := c[seg]
+			if !ok {
+				return nil, false
+			}
+			cur = next
+		case []interface{}:
+			idx, err := strconv.Atoi(seg)
+			if err != nil || idx < 0 || idx >= len(c) {
+				return nil, false
+			}
+			cur = c[idx]
+		default:
+			return nil, false
+		}
+	}
+	if n, ok := cur.(json.Number); ok {
+		if i, err := n.Int64(); err == nil {
+			return i, true
+		}
+		if f, err := n.Float64(); err == nil {
+			return f, true
+		}
+		return nil, false
+	}
+	return cur, true
+}
+
+// MultiValuer returns a Valuer that queries each of valuers in order,
+// returning the first match; e.g. composing a NowValuer with a MapValuer
+// lets "now()" resolve even though the map itself has no such entry.
+func MultiValuer(valuers ...Valuer) Valuer {
+	return multiValuer(valuers)
+}
+
+type multiValuer []Valuer
+
+func (a multiValuer) Value(key string) (interface{}, bool) {
+	for _, valuer := range a {
+		if valuer == nil {
+			continue
+		}
+		if v, ok := valuer.Value(key); ok {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
 // ContainsVarRef returns true if expr is a VarRef or contains one.
 func ContainsVarRef(expr Expr) bool {
 	var v containsVarRefVisitor
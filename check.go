@@ -0,0 +1,273 @@
+package jepl
+
+import "fmt"
+
+// Type is the static type Check infers for an expression.
+type Type int
+
+const (
+	TypeAny Type = iota
+	TypeInt
+	TypeFloat
+	TypeString
+	TypeBool
+	TypeRegex
+	TypeList
+)
+
+func (t Type) String() string {
+	switch t {
+	case TypeInt:
+		return "int"
+	case TypeFloat:
+		return "float"
+	case TypeString:
+		return "string"
+	case TypeBool:
+		return "bool"
+	case TypeRegex:
+		return "regex"
+	case TypeList:
+		return "list"
+	default:
+		return "any"
+	}
+}
+
+// CheckError describes one problem Check found while walking an
+// expression. Pos is the zero value until JEPL has a parser that threads
+// token positions onto AST nodes; it's included now so callers and
+// error-display code don't need to change once that lands.
+type CheckError struct {
+	Pos     Pos
+	Message string
+}
+
+func (e CheckError) Error() string { return e.Message }
+
+// numeric reports whether t is one JEPL treats as a number for
+// arithmetic and ordering operators.
+func numeric(t Type) bool { return t == TypeInt || t == TypeFloat || t == TypeAny }
+
+// Check walks expr once, reporting every operator/operand combination
+// evalBinaryExpr would silently turn into a nil result, every VarRef not
+// present in env, and every division by a literal zero. It returns the
+// errors found; the type inferred for expr is not returned, and the
+// error result is always nil. A caller can validate a whole rule (e.g. every Field.Expr and Condition in a
+// SelectStatement) before it ever runs against live data.
+func Check(expr Expr, env map[string]Type) ([]CheckError, error) {
+	_, errs := check(expr, env)
+	return errs, nil
+}
+
+func check(expr Expr, env map[string]Type) (Type, []CheckError) {
+	switch expr := expr.(type) {
+	case nil:
+		return TypeAny, nil
+	case *BooleanLiteral:
+		return TypeBool, nil
+	case *IntegerLiteral:
+		return TypeInt, nil
+	case *NumberLiteral:
+		return TypeFloat, nil
+	case *StringLiteral:
+		return TypeString, nil
+	case *RegexLiteral:
+		return TypeRegex, nil
+	case *ListLiteral:
+		return TypeList, nil
+	case *nilLiteral:
+		return TypeAny, nil
+	case *ParenExpr:
+		return check(expr.Expr, env)
+	case *VarRef:
+		t, ok := env[expr.Val]
+		if !ok {
+			return TypeAny, []CheckError{{Message: fmt.Sprintf("jepl: unknown identifier %q", expr.Val)}}
+		}
+		return t, nil
+	case *Call:
+		var errs []CheckError
+		for _, a := range expr.Args {
+			_, argErrs := check(a, env)
+			errs = append(errs, argErrs...)
+		}
+		// len/contains are evaluated per document as scalar functions
+		// (evalScalarFunc in eval.go). Every other Call is typed as
+		// float64, including top, bottom, sample, mode, first, last and
+		// topk, whose Aggregators return lists or field values.
+		switch expr.Name {
+		case "len":
+			return TypeInt, errs
+		case "contains":
+			return TypeBool, errs
+		}
+		return TypeFloat, errs
+	case *ConditionalExpr:
+		var errs []CheckError
+		_, condErrs := check(expr.Cond, env)
+		errs = append(errs, condErrs...)
+		trueType, trueErrs := check(expr.TrueExpr, env)
+		errs = append(errs, trueErrs...)
+		falseType, falseErrs := check(expr.FalseExpr, env)
+		errs = append(errs, falseErrs...)
+		if trueType != falseType && trueType != TypeAny && falseType != TypeAny {
+			errs = append(errs, CheckError{Message: fmt.Sprintf(
+				"jepl: conditional expression %q has mismatched branch types %s and %s", expr.String(), trueType, falseType)})
+		}
+		return trueType, errs
+	case *IndexExpr:
+		var errs []CheckError
+		listType, listErrs := check(expr.Expr, env)
+		errs = append(errs, listErrs...)
+		if listType != TypeList && listType != TypeAny {
+			errs = append(errs, CheckError{Message: fmt.Sprintf("jepl: indexing requires a list, got %s", listType)})
+		}
+		_, idxErrs := check(expr.Index, env)
+		errs = append(errs, idxErrs...)
+		return TypeAny, errs
+	case *SliceExpr:
+		var errs []CheckError
+		listType, listErrs := check(expr.Expr, env)
+		errs = append(errs, listErrs...)
+		if listType != TypeList && listType != TypeAny {
+			errs = append(errs, CheckError{Message: fmt.Sprintf("jepl: slicing requires a list, got %s", listType)})
+		}
+		if expr.Low != nil {
+			_, lowErrs := check(expr.Low, env)
+			errs = append(errs, lowErrs...)
+		}
+		if expr.High != nil {
+			_, highErrs := check(expr.High, env)
+			errs = append(errs, highErrs...)
+		}
+		return TypeList, errs
+	case *CastExpr:
+		_, errs := check(expr.Expr, env)
+		switch expr.Type {
+		case "integer":
+			return TypeInt, errs
+		case "float":
+			return TypeFloat, errs
+		case "string":
+			return TypeString, errs
+		case "boolean":
+			return TypeBool, errs
+		default:
+			return TypeAny, append(errs, CheckError{Message: fmt.Sprintf("jepl: unknown cast type %q", expr.Type)})
+		}
+	case *BinaryExpr:
+		return checkBinaryExpr(expr, env)
+	default:
+		return TypeAny, []CheckError{{Message: fmt.Sprintf("jepl: Check: unsupported expression %T", expr)}}
+	}
+}
+
+func checkBinaryExpr(expr *BinaryExpr, env map[string]Type) (Type, []CheckError) {
+	lhs, errs := check(expr.LHS, env)
+	rhs, rhsErrs := check(expr.RHS, env)
+	errs = append(errs, rhsErrs...)
+
+	switch expr.Op {
+	case AND, OR:
+		if lhs != TypeBool && lhs != TypeAny {
+			errs = append(errs, CheckError{Message: fmt.Sprintf("jepl: %s requires bool operands, got %s", expr.Op, lhs)})
+		}
+		if rhs != TypeBool && rhs != TypeAny {
+			errs = append(errs, CheckError{Message: fmt.Sprintf("jepl: %s requires bool operands, got %s", expr.Op, rhs)})
+		}
+		return TypeBool, errs
+	case EQREGEX, NEQREGEX:
+		if lhs != TypeString && lhs != TypeAny {
+			errs = append(errs, CheckError{Message: fmt.Sprintf("jepl: %s requires a string operand, got %s", expr.Op, lhs)})
+		}
+		if rhs != TypeRegex && rhs != TypeAny {
+			errs = append(errs, CheckError{Message: fmt.Sprintf("jepl: %s requires a regex operand, got %s", expr.Op, rhs)})
+		}
+		return TypeBool, errs
+	case IN, NI:
+		if rhs != TypeList && rhs != TypeAny {
+			errs = append(errs, CheckError{Message: fmt.Sprintf("jepl: %s requires a list on the right, got %s", expr.Op, rhs)})
+		}
+		return TypeBool, errs
+	case CONTAINS:
+		if lhs != TypeList && lhs != TypeAny {
+			errs = append(errs, CheckError{Message: fmt.Sprintf("jepl: %s requires a list on the left, got %s", expr.Op, lhs)})
+		}
+		return TypeBool, errs
+	case LT, LTE, GT, GTE:
+		if !numeric(lhs) || !numeric(rhs) {
+			errs = append(errs, CheckError{Message: fmt.Sprintf("jepl: %s requires numeric operands, got %s and %s", expr.Op, lhs, rhs)})
+		}
+		return TypeBool, errs
+	case EQ, NEQ:
+		return TypeBool, errs
+	case ADD, SUB, MUL, DIV, MOD:
+		if !numeric(lhs) || !numeric(rhs) {
+			errs = append(errs, CheckError{Message: fmt.Sprintf("jepl: %s requires numeric operands, got %s and %s", expr.Op, lhs, rhs)})
+		}
+		if (expr.Op == DIV || expr.Op == MOD) && isLiteralZero(expr.RHS) {
+			errs = append(errs, CheckError{Message: fmt.Sprintf("jepl: %s by literal zero", expr.Op)})
+		}
+		resultType := TypeFloat
+		if lhs == TypeInt && rhs == TypeInt {
+			resultType = TypeInt
+		}
+		return resultType, errs
+	default:
+		return TypeAny, append(errs, CheckError{Message: fmt.Sprintf("jepl: Check: unsupported operator %s", expr.Op)})
+	}
+}
+
+// checkFilterType is a lightweight, env-free companion to check used to
+// validate a WHERE clause as it's parsed, before any document (and thus
+// any env) exists. It only ever flags a literal: an ordering or
+// arithmetic operator fed a string literal operand. VarRefs and Calls
+// are of unknown type here and are never flagged; that's check's job
+// once a real env is available.
+func checkFilterType(expr Expr) (Type, error) {
+	switch expr := expr.(type) {
+	case *StringLiteral:
+		return TypeString, nil
+	case *IntegerLiteral:
+		return TypeInt, nil
+	case *NumberLiteral:
+		return TypeFloat, nil
+	case *BooleanLiteral:
+		return TypeBool, nil
+	case *ParenExpr:
+		return checkFilterType(expr.Expr)
+	case *BinaryExpr:
+		lhs, err := checkFilterType(expr.LHS)
+		if err != nil {
+			return TypeAny, err
+		}
+		rhs, err := checkFilterType(expr.RHS)
+		if err != nil {
+			return TypeAny, err
+		}
+		switch expr.Op {
+		case LT, LTE, GT, GTE, ADD, SUB, MUL, DIV, MOD:
+			if lhs == TypeString || rhs == TypeString {
+				return TypeAny, fmt.Errorf("invalid filter, unsupport op %s for string", expr.Op)
+			}
+		}
+		return TypeFloat, nil
+	default:
+		return TypeAny, nil
+	}
+}
+
+// isLiteralZero reports whether expr is the literal 0 or 0.0, the case
+// evalBinaryExpr's DIV and MOD branches silently turn into NaN instead
+// of failing.
+func isLiteralZero(expr Expr) bool {
+	switch expr := expr.(type) {
+	case *IntegerLiteral:
+		return expr.Val == 0
+	case *NumberLiteral:
+		return expr.Val == 0
+	default:
+		return false
+	}
+}
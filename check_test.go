@@ -0,0 +1,81 @@
+package jepl_test
+
+import (
+	"github.com/chenyoufu/jepl"
+	"testing"
+)
+
+// Ensure Check reports every operator/operand combination
+// evalBinaryExpr would otherwise silently turn into nil, plus unknown
+// identifiers and division by a literal zero.
+func TestCheck(t *testing.T) {
+	for i, tt := range []struct {
+		expr jepl.Expr
+		env  map[string]jepl.Type
+		errs int
+	}{
+		// AND/OR require bool operands.
+		{
+			expr: &jepl.BinaryExpr{Op: jepl.AND, LHS: &jepl.IntegerLiteral{Val: 1}, RHS: &jepl.IntegerLiteral{Val: 2}},
+			errs: 2,
+		},
+		// EQREGEX requires a string LHS and a regex RHS.
+		{
+			expr: &jepl.BinaryExpr{Op: jepl.EQREGEX, LHS: &jepl.IntegerLiteral{Val: 1}, RHS: &jepl.StringLiteral{Val: "x"}},
+			errs: 2,
+		},
+		// IN requires a list on the right.
+		{
+			expr: &jepl.BinaryExpr{Op: jepl.IN, LHS: &jepl.IntegerLiteral{Val: 1}, RHS: &jepl.IntegerLiteral{Val: 2}},
+			errs: 1,
+		},
+		// Division by a literal zero is flagged, in addition to being numeric.
+		{
+			expr: &jepl.BinaryExpr{Op: jepl.DIV, LHS: &jepl.IntegerLiteral{Val: 1}, RHS: &jepl.IntegerLiteral{Val: 0}},
+			errs: 1,
+		},
+		// An identifier missing from env is unknown.
+		{
+			expr: &jepl.VarRef{Val: "foo"},
+			env:  map[string]jepl.Type{},
+			errs: 1,
+		},
+		// A declared identifier is fine.
+		{
+			expr: &jepl.VarRef{Val: "foo"},
+			env:  map[string]jepl.Type{"foo": jepl.TypeInt},
+			errs: 0,
+		},
+		// Well-typed numeric comparison.
+		{
+			expr: &jepl.BinaryExpr{Op: jepl.GT, LHS: &jepl.IntegerLiteral{Val: 1}, RHS: &jepl.NumberLiteral{Val: 2}},
+			errs: 0,
+		},
+	} {
+		errs, err := jepl.Check(tt.expr, tt.env)
+		if err != nil {
+			t.Fatalf("%d. unexpected error: %s", i, err)
+		}
+		if len(errs) != tt.errs {
+			t.Errorf("%d. %s: expected %d error(s), got %d: %v", i, tt.expr, tt.errs, len(errs), errs)
+		}
+	}
+}
+
+// Ensure Check reports a mismatched ConditionalExpr branch type
+// (string vs. int), since that's the one shape checkBinaryExpr can't
+// catch on its own.
+func TestCheckConditionalExprMismatch(t *testing.T) {
+	mismatched := &jepl.ConditionalExpr{
+		Cond:      &jepl.BooleanLiteral{Val: true},
+		TrueExpr:  &jepl.StringLiteral{Val: "a"},
+		FalseExpr: &jepl.IntegerLiteral{Val: 1},
+	}
+	errs, err := jepl.Check(mismatched, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(errs) != 1 {
+		t.Errorf("expected 1 error for mismatched ternary branches, got %d: %v", len(errs), errs)
+	}
+}
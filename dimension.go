@@ -0,0 +1,85 @@
+package jepl
+
+import (
+	"strings"
+	"time"
+)
+
+// Dimension represents a single GROUP BY expression: either a bare tag
+// identifier or a time(size[, every]) call describing a window.
+type Dimension struct {
+	Expr Expr
+}
+
+// String returns a string representation of the dimension.
+func (d *Dimension) String() string { return d.Expr.String() }
+
+// Dimensions represents a list of dimensions.
+type Dimensions []*Dimension
+
+// String returns a string representation of the dimensions.
+func (a Dimensions) String() string {
+	var str []string
+	for _, d := range a {
+		str = append(str, d.String())
+	}
+	return strings.Join(str, ", ")
+}
+
+// TimeWindow reports whether d is a GROUP BY time(...) dimension, and if
+// so the WindowSpec it describes. time(size) is a tumbling window;
+// time(size, every) is a sliding window.
+func (d *Dimension) TimeWindow() (WindowSpec, bool) {
+	call, ok := d.Expr.(*Call)
+	if !ok || call.Name != "time" || len(call.Args) == 0 {
+		return WindowSpec{}, false
+	}
+
+	size, ok := durationArg(call.Args[0])
+	if !ok {
+		return WindowSpec{}, false
+	}
+
+	spec := WindowSpec{Size: size, Every: size}
+	if len(call.Args) > 1 {
+		if every, ok := durationArg(call.Args[1]); ok {
+			spec.Every = every
+		}
+	}
+	return spec, true
+}
+
+// durationArg resolves a time(...) argument, accepting either a duration
+// string literal ("1m", "10s") or a bare integer number of seconds.
+func durationArg(expr Expr) (time.Duration, bool) {
+	switch v := expr.(type) {
+	case *StringLiteral:
+		d, err := time.ParseDuration(v.Val)
+		return d, err == nil
+	case *IntegerLiteral:
+		return time.Duration(v.Val) * time.Second, true
+	}
+	return 0, false
+}
+
+// TagDimensions returns the GROUP BY dimensions that are not a time(...)
+// window, i.e. the tag keys events are folded over.
+func (s *SelectStatement) TagDimensions() Dimensions {
+	var out Dimensions
+	for _, d := range s.Dimensions {
+		if _, ok := d.TimeWindow(); !ok {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+// WindowDimension returns the GROUP BY time(...) dimension, if s has one.
+func (s *SelectStatement) WindowDimension() (*Dimension, bool) {
+	for _, d := range s.Dimensions {
+		if _, ok := d.TimeWindow(); ok {
+			return d, true
+		}
+	}
+	return nil, false
+}
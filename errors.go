@@ -0,0 +1,72 @@
+package jepl
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Phase tags which stage of processing produced an EvalError.
+type Phase string
+
+const (
+	PhaseParse        Phase = "parse"
+	PhaseType         Phase = "type"
+	PhaseEval         Phase = "eval"
+	PhaseMissingField Phase = "missing_field"
+)
+
+// EvalError carries the Expr that failed, the phase it failed in, and
+// the underlying cause. Pos is the zero value until JEPL's parser
+// threads source positions onto AST nodes (see token.go's Pos); it's
+// carried now so this error's shape won't need to change once that lands.
+type EvalError struct {
+	Expr  Expr
+	Pos   Pos
+	Phase Phase
+	Err   error
+}
+
+func (e *EvalError) Error() string {
+	if e.Expr == nil {
+		return fmt.Sprintf("jepl: %s: %v", e.Phase, e.Err)
+	}
+	return fmt.Sprintf("jepl: %s: %q: %v", e.Phase, e.Expr.String(), e.Err)
+}
+
+// Unwrap exposes the underlying cause to errors.Is/errors.As.
+func (e *EvalError) Unwrap() error { return e.Err }
+
+// errMissingField is the cause EvalStrict reports for a *VarRef whose
+// Segments don't resolve against the document.
+var errMissingField = errors.New("field not present in document")
+
+// errUnsupportedFieldType is the cause EvalStrict reports for a *VarRef
+// resolving to a JSON type Eval's number/string/bool/array switch doesn't
+// handle (e.g. an object or null field).
+var errUnsupportedFieldType = errors.New("field type not supported in this expression")
+
+// errDivByZero is the cause EvalStrict reports whenever a DIV or MOD
+// produces NaN; a NaN that comes from a NaN operand is reported with this
+// cause as well.
+var errDivByZero = errors.New("division by zero")
+
+// EvalContext threads strict-mode evaluation state through EvalStrict.
+// In lax mode (StrictMode false, matching Eval's long-standing
+// null-propagation behavior) a missing field or eval failure silently
+// evaluates to nil; in strict mode it's additionally recorded as an
+// EvalError in Errors, so a caller can validate a document/rule pair and
+// decide whether to trust a nil result.
+type EvalContext struct {
+	StrictMode bool
+	Errors     []*EvalError
+}
+
+// fail records err against expr/phase in strict mode. A nil ctx, or one
+// with StrictMode false, is a no-op, so callers that don't care about
+// structured errors get exactly today's lax behavior.
+func (c *EvalContext) fail(expr Expr, phase Phase, err error) {
+	if c == nil || !c.StrictMode {
+		return
+	}
+	c.Errors = append(c.Errors, &EvalError{Expr: expr, Phase: phase, Err: err})
+}
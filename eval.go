@@ -3,8 +3,8 @@ package jepl
 import (
 	"fmt"
 	"github.com/buger/jsonparser"
-	"reflect"
-	"regexp"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -24,15 +24,30 @@ func (s *SelectStatement) evalMetric() Points {
 	return ps
 }
 
-//EvalSQL return metric points map[filter]metric
-func EvalSQL(sql string, docs []string) map[string]Points {
+// EvalMetric returns the current aggregated Points for s's SELECT
+// fields, for callers outside this package (e.g. jepl/sink's Engine)
+// that already hold a *SelectStatement populated by FlatStatByGroup or
+// an Evaluator and just need its result.
+func (s *SelectStatement) EvalMetric() Points {
+	return s.evalMetric()
+}
+
+// EvalSQL returns metric points keyed by the WHERE filter (or, with GROUP
+// BY, by the group's dimension values joined by "\x1f"), along with an
+// aggregated error describing every document/rule pairing that failed
+// to evaluate. A parse failure still aborts immediately (there's no
+// statement to run), but once running, one bad document's WHERE clause
+// no longer panics or silently logs to stdout — it's recorded and the
+// rest of the batch still completes, so a single malformed document
+// can't kill an otherwise-healthy pipeline.
+func EvalSQL(sql string, docs []string) (map[string]Points, error) {
 	stmt, err := ParseStatement(sql)
 	if err != nil {
-		panic(err)
+		return nil, &EvalError{Phase: PhaseParse, Err: err}
 	}
 	selectStmt, ok := stmt.(*SelectStatement)
 	if !ok {
-		panic("Not support stmt")
+		return nil, &EvalError{Phase: PhaseParse, Err: fmt.Errorf("jepl: EvalSQL only supports SELECT statements")}
 	}
 
 	pm := make(map[string]Points)
@@ -44,21 +59,39 @@ func EvalSQL(sql string, docs []string) map[string]Points {
 		selectStmts = selectStmt.FlatStatByGroup(docs)
 	}
 
+	var errs []*EvalError
 	for k, st := range selectStmts {
-		for _, doc := range docs {
+		for i, doc := range docs {
 			switch res := Eval(st.Condition, &doc).(type) {
 			case bool:
 				if res == true {
-					st.evalFunctionCalls(&doc)
+					// FlatStatByGroup has already folded each document
+					// into its own group; only the ungrouped statement is
+					// fed here.
+					if len(selectStmt.Dimensions) == 0 {
+						st.EvalFunctionCalls(&doc)
+					}
 				}
 			default:
-				fmt.Println("Select Where Condition parse error")
+				errs = append(errs, &EvalError{
+					Expr:  st.Condition,
+					Phase: PhaseEval,
+					Err:   fmt.Errorf("document %d: WHERE condition did not evaluate to a bool", i),
+				})
 			}
 		}
 		ms := st.evalMetric()
 		pm[k] = ms
 	}
-	return pm
+
+	if len(errs) > 0 {
+		msgs := make([]string, len(errs))
+		for i, e := range errs {
+			msgs[i] = e.Error()
+		}
+		return pm, fmt.Errorf("jepl: EvalSQL: %d document(s) failed: %s", len(errs), strings.Join(msgs, "; "))
+	}
+	return pm, nil
 }
 
 // Eval evaluates expr against a map.
@@ -69,28 +102,41 @@ func Eval(expr Expr, js *string) interface{} {
 
 	switch expr := expr.(type) {
 	case *Call:
-		var ret interface{}
-
-		if expr.Name == "count" {
-			ret = float64(expr.Count)
-		} else {
-			ret = expr.result
-			if expr.Name == "avg" {
-				if expr.Count > 0 {
-					ret = expr.result / float64(expr.Count)
-				}
+		// js is nil exactly when a finished SelectStatement is reading
+		// back a field's final aggregated value (evalMetric), as opposed
+		// to evaluating against a live document (WHERE, or a nested
+		// argument inside evalFC) — scalar functions like len/contains
+		// only make sense in the latter case, so leave the former to the
+		// existing Aggregator.Result() path (this also keeps SELECT
+		// len(tags) routed through lenAggregator instead of reading the
+		// last document's length directly).
+		if js != nil {
+			if v, ok := evalScalarFunc(expr, js); ok {
+				return v
 			}
 		}
-
-		expr.result = 0.0
-		expr.First = true
-		expr.Count = 0
-
+		agg, err := expr.Aggregator()
+		if err != nil {
+			return nil
+		}
+		ret := agg.Result()
+		agg.Reset()
 		return ret
+	case *ConditionalExpr:
+		// Short-circuit: only the selected branch is evaluated, so a
+		// *Call in the unused branch never advances its Aggregator.
+		if EvalBool(expr.Cond, js) {
+			return Eval(expr.TrueExpr, js)
+		}
+		return Eval(expr.FalseExpr, js)
 	case *BinaryExpr:
 		return evalBinaryExpr(expr, js)
 	case *BooleanLiteral:
 		return expr.Val
+	case *CastExpr:
+		return castValue(Eval(expr.Expr, js), expr.Type)
+	case *IndexExpr:
+		return evalIndex(Eval(expr.Expr, js), Eval(expr.Index, js))
 	case *ListLiteral:
 		return expr.Vals
 	case *IntegerLiteral:
@@ -99,6 +145,15 @@ func Eval(expr Expr, js *string) interface{} {
 		return expr.Val
 	case *ParenExpr:
 		return Eval(expr.Expr, js)
+	case *SliceExpr:
+		var low, high interface{}
+		if expr.Low != nil {
+			low = Eval(expr.Low, js)
+		}
+		if expr.High != nil {
+			high = Eval(expr.High, js)
+		}
+		return evalSlice(Eval(expr.Expr, js), low, high)
 	case *RegexLiteral:
 		return expr.Val
 	case *StringLiteral:
@@ -118,11 +173,16 @@ func Eval(expr Expr, js *string) interface{} {
 				v, _ := jsonparser.ParseBoolean(val)
 				return v
 
+			case jsonparser.Array:
+				return evalJSONArray(val)
+
 			default:
 				return nil
 			}
 		} else {
-			fmt.Println(err, expr.Segments)
+			// Lax mode: a missing/unparseable field is just another
+			// null, same as any other absent value. A caller that wants
+			// to know why should use EvalStrict instead.
 			return nil
 		}
 	default:
@@ -131,169 +191,14 @@ func Eval(expr Expr, js *string) interface{} {
 
 }
 
+// evalBinaryExpr evaluates both sides against js, then applies expr.Op
+// through applyBinaryOp — the same operator engine EvalValuer uses for
+// the VM's Valuer-backed path, so the two evaluators never disagree
+// about what an operator does to a given pair of operand types.
 func evalBinaryExpr(expr *BinaryExpr, js *string) interface{} {
 	lhs := Eval(expr.LHS, js)
 	rhs := Eval(expr.RHS, js)
-
-	// Evaluate if both sides are simple types.
-	switch lhs := lhs.(type) {
-	case bool:
-		rhs, ok := rhs.(bool)
-		switch expr.Op {
-		case AND:
-			return ok && (lhs && rhs)
-		case OR:
-			return ok && (lhs || rhs)
-		case EQ:
-			return ok && (lhs == rhs)
-		case NEQ:
-			return ok && (lhs != rhs)
-		}
-	case float64:
-		// Try the rhs as a float64 or int64
-		rhsf, ok := rhs.(float64)
-		if !ok {
-			var rhsi int64
-			if rhsi, ok = rhs.(int64); ok {
-				rhsf = float64(rhsi)
-			}
-		}
-
-		switch expr.Op {
-		case IN:
-			return inList(lhs, rhs)
-		case NI:
-			return !inList(lhs, rhs)
-		case EQ:
-			return ok && (lhs == rhsf)
-		case NEQ:
-			return ok && (lhs != rhsf)
-		case LT:
-			return ok && (lhs < rhsf)
-		case LTE:
-			return ok && (lhs <= rhsf)
-		case GT:
-			return ok && (lhs > rhsf)
-		case GTE:
-			return ok && (lhs >= rhsf)
-		case ADD:
-			if !ok {
-				return nil
-			}
-			return lhs + rhsf
-		case SUB:
-			if !ok {
-				return nil
-			}
-			return lhs - rhsf
-		case MUL:
-			if !ok {
-				return nil
-			}
-			return lhs * rhsf
-		case DIV:
-			if !ok {
-				return nil
-			} else if rhs == 0 {
-				return float64(0)
-			}
-			return lhs / rhsf
-		}
-	case int64:
-		// Try as a float64 to see if a float cast is required.
-		rhsf, ok := rhs.(float64)
-		if ok {
-			lhs := float64(lhs)
-			rhs := rhsf
-			switch expr.Op {
-			case EQ:
-				return lhs == rhs
-			case NEQ:
-				return lhs != rhs
-			case LT:
-				return lhs < rhs
-			case LTE:
-				return lhs <= rhs
-			case GT:
-				return lhs > rhs
-			case GTE:
-				return lhs >= rhs
-			case ADD:
-				return lhs + rhs
-			case SUB:
-				return lhs - rhs
-			case MUL:
-				return lhs * rhs
-			case DIV:
-				if rhs == 0 {
-					return float64(0)
-				}
-				return lhs / rhs
-			}
-		} else {
-			rhsi, ok := rhs.(int64)
-			switch expr.Op {
-			case IN:
-				return inList(lhs, rhs)
-			case NI:
-				return !inList(lhs, rhs)
-			case EQ:
-				return ok && (lhs == rhsi)
-			case NEQ:
-				return ok && (lhs != rhsi)
-			case LT:
-				return ok && (lhs < rhsi)
-			case LTE:
-				return ok && (lhs <= rhsi)
-			case GT:
-				return ok && (lhs > rhsi)
-			case GTE:
-				return ok && (lhs >= rhsi)
-			case ADD:
-				if !ok {
-					return nil
-				}
-				return lhs + rhsi
-			case SUB:
-				if !ok {
-					return nil
-				}
-				return lhs - rhsi
-			case MUL:
-				if !ok {
-					return nil
-				}
-				return lhs * rhsi
-			case DIV:
-				if !ok {
-					return nil
-				} else if rhs == 0 {
-					return float64(0)
-				}
-				return lhs / rhsi
-			}
-		}
-	case string:
-		switch expr.Op {
-		case IN:
-			return inList(lhs, rhs)
-		case NI:
-			return !inList(lhs, rhs)
-		case EQ:
-			rhs, ok := rhs.(string)
-			return ok && lhs == rhs
-		case NEQ:
-			rhs, ok := rhs.(string)
-			return ok && lhs != rhs
-		case EQREGEX:
-			rhs, ok := rhs.(*regexp.Regexp)
-			return ok && rhs.MatchString(lhs)
-		case NEQREGEX:
-			rhs, ok := rhs.(*regexp.Regexp)
-			return ok && !rhs.MatchString(lhs)
-		}
-	}
-	return nil
+	return applyBinaryOp(expr.Op, lhs, rhs)
 }
 
 // EvalBool evaluates expr and returns true if result is a boolean true.
@@ -303,80 +208,155 @@ func EvalBool(expr Expr, js *string) bool {
 	return v
 }
 
-// FunctionCalls returns the Call objects from the query
-func (s *SelectStatement) evalFunctionCalls(js *string) {
+// EvalFunctionCalls feeds doc into every Call in s's fields, advancing
+// each one's Aggregator by one document.
+func (s *SelectStatement) EvalFunctionCalls(js *string) {
 	for _, f := range s.Fields {
 		evalFC(f.Expr, js)
 	}
 }
 
+// evalFC looks up expr's Aggregator from the registry (see
+// aggregator.go's RegisterAggregator/Call.Aggregator) and feeds it
+// expr's argument evaluated against js, rather than switching on
+// expr.Name — adding a new aggregate only requires registering a
+// factory, not a change here.
 func evalFC(expr Expr, js *string) {
 	switch expr := expr.(type) {
 	case *Call:
 		expr.Count++
 
-		switch expr.Name {
-		case "sum", "avg":
-			switch res := Eval(expr.Args[0], js).(type) {
-			case int64:
-				expr.result += float64(res)
-			case float64:
-				expr.result += res
-			}
-		case "max":
-			var thisret float64
-			switch res := Eval(expr.Args[0], js).(type) {
-			case int64:
-				thisret = float64(res)
-			case float64:
-				thisret = res
-			}
-			if expr.First {
-				expr.result = thisret
-				expr.First = false
-			} else {
-				if thisret > expr.result {
-					expr.result = thisret
-				}
-			}
-
-		case "min":
-			var thisret float64
-			switch res := Eval(expr.Args[0], js).(type) {
-			case int64:
-				thisret = float64(res)
-			case float64:
-				thisret = res
-			}
-			if expr.First {
-				expr.result = thisret
-				expr.First = false
-			} else {
-				if thisret < expr.result {
-					expr.result = thisret
-				}
-			}
-
+		agg, err := expr.Aggregator()
+		if err != nil {
+			return
 		}
+		agg.Update(Eval(expr.Args[0], js), time.Now().UnixNano())
 	case *BinaryExpr:
 		evalFC(expr.LHS, js)
 		evalFC(expr.RHS, js)
 	}
 }
 
-func inList(val interface{}, array interface{}) (exists bool) {
-	exists = false
+// castValue coerces v into typ ("integer", "float", "string", "boolean")
+// using strconv-based conversion. It returns nil for an unparseable
+// string or an input type it doesn't recognize for typ, rather than
+// panicking or silently returning a zero value that could be confused
+// with a real 0/false/"" result.
+func castValue(v interface{}, typ string) interface{} {
+	switch typ {
+	case "integer":
+		switch v := v.(type) {
+		case int64:
+			return v
+		case float64:
+			// Truncates toward zero, same as a Go numeric conversion.
+			return int64(v)
+		case string:
+			i, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return nil
+			}
+			return i
+		}
+	case "float":
+		switch v := v.(type) {
+		case float64:
+			return v
+		case int64:
+			return float64(v)
+		case string:
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return nil
+			}
+			return f
+		}
+	case "string":
+		switch v := v.(type) {
+		case string:
+			return v
+		case int64:
+			return strconv.FormatInt(v, 10)
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64)
+		case bool:
+			return strconv.FormatBool(v)
+		}
+	case "boolean":
+		switch v := v.(type) {
+		case bool:
+			return v
+		case string:
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil
+			}
+			return b
+		}
+	}
+	return nil
+}
 
-	switch reflect.TypeOf(array).Kind() {
-	case reflect.Slice:
-		s := reflect.ValueOf(array)
+// evalJSONArray decodes a jsonparser.Array value into a []interface{},
+// using the same Number/String/Boolean decoding as the scalar VarRef
+// cases above; an element of any other JSON type (nested array/object)
+// decodes to nil rather than failing the whole field.
+func evalJSONArray(val []byte) []interface{} {
+	var arr []interface{}
+	jsonparser.ArrayEach(val, func(item []byte, dt jsonparser.ValueType, offset int, err error) {
+		switch dt {
+		case jsonparser.Number:
+			v, _ := jsonparser.ParseFloat(item)
+			arr = append(arr, v)
+		case jsonparser.String:
+			v, _ := jsonparser.ParseString(item)
+			arr = append(arr, v)
+		case jsonparser.Boolean:
+			v, _ := jsonparser.ParseBoolean(item)
+			arr = append(arr, v)
+		default:
+			arr = append(arr, nil)
+		}
+	})
+	return arr
+}
 
-		for i := 0; i < s.Len(); i++ {
-			if reflect.DeepEqual(val, s.Index(i).Interface()) == true {
-				exists = true
-				return
-			}
+// evalScalarFunc evaluates the handful of Call names that are plain
+// per-document scalar functions rather than cross-document aggregators:
+// unlike expr.Aggregator(), these never touch Call.Count/Update/Reset,
+// so they're safe to call repeatedly within one document (in WHERE, or
+// nested inside a real aggregate's argument, e.g. avg(len(tags))). The
+// bool return reports whether expr.Name named one of these functions at
+// all, so callers fall back to the Aggregator path otherwise.
+func evalScalarFunc(expr *Call, js *string) (interface{}, bool) {
+	switch expr.Name {
+	case "len":
+		if len(expr.Args) != 1 {
+			return nil, true
+		}
+		return scalarLen(Eval(expr.Args[0], js)), true
+	case "contains":
+		if len(expr.Args) != 2 {
+			return nil, true
 		}
+		list := Eval(expr.Args[0], js)
+		val := Eval(expr.Args[1], js)
+		return in_array(val, list), true
 	}
-	return
+	return nil, false
 }
+
+// scalarLen returns the element count of a list-valued or string-valued
+// v, or nil if v is neither. Unlike lenAggregator, which counts only
+// list values, a string's length is counted here too.
+func scalarLen(v interface{}) interface{} {
+	switch v := v.(type) {
+	case []interface{}:
+		return int64(len(v))
+	case string:
+		return int64(len(v))
+	default:
+		return nil
+	}
+}
+
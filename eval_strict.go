@@ -0,0 +1,164 @@
+package jepl
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/buger/jsonparser"
+)
+
+// EvalStrict evaluates expr against js exactly like Eval, except that a
+// *VarRef whose Segments don't resolve against js, an unknown Call
+// aggregator, or a DIV/MOD that produced NaN records an *EvalError on
+// ctx (when ctx.StrictMode is set) instead of only ever returning nil.
+// Passing a nil ctx, or one with StrictMode false, makes this behave
+// exactly like Eval (nothing is recorded, nothing panics).
+func EvalStrict(expr Expr, js *string, ctx *EvalContext) interface{} {
+	if expr == nil {
+		return nil
+	}
+
+	switch expr := expr.(type) {
+	case *Call:
+		// See Eval's identical js-nil guard: scalar functions only apply
+		// when evaluating against a live document, not when reading back
+		// a finished Aggregator's Result().
+		if js != nil {
+			if v, ok := evalScalarFuncStrict(expr, js, ctx); ok {
+				return v
+			}
+		}
+		agg, err := expr.Aggregator()
+		if err != nil {
+			ctx.fail(expr, PhaseEval, err)
+			return nil
+		}
+		ret := agg.Result()
+		agg.Reset()
+		return ret
+	case *ConditionalExpr:
+		if EvalBoolStrict(expr.Cond, js, ctx) {
+			return EvalStrict(expr.TrueExpr, js, ctx)
+		}
+		return EvalStrict(expr.FalseExpr, js, ctx)
+	case *BinaryExpr:
+		return evalBinaryExprStrict(expr, js, ctx)
+	case *BooleanLiteral:
+		return expr.Val
+	case *CastExpr:
+		inner := EvalStrict(expr.Expr, js, ctx)
+		out := castValue(inner, expr.Type)
+		if out == nil && inner != nil {
+			ctx.fail(expr, PhaseType, fmt.Errorf("cannot cast %T to %s", inner, expr.Type))
+		}
+		return out
+	case *IndexExpr:
+		return evalIndex(EvalStrict(expr.Expr, js, ctx), EvalStrict(expr.Index, js, ctx))
+	case *ListLiteral:
+		return expr.Vals
+	case *IntegerLiteral:
+		return expr.Val
+	case *NumberLiteral:
+		return expr.Val
+	case *ParenExpr:
+		return EvalStrict(expr.Expr, js, ctx)
+	case *SliceExpr:
+		var low, high interface{}
+		if expr.Low != nil {
+			low = EvalStrict(expr.Low, js, ctx)
+		}
+		if expr.High != nil {
+			high = EvalStrict(expr.High, js, ctx)
+		}
+		return evalSlice(EvalStrict(expr.Expr, js, ctx), low, high)
+	case *RegexLiteral:
+		return expr.Val
+	case *StringLiteral:
+		return expr.Val
+	case *VarRef:
+		val, dt, _, err := jsonparser.Get([]byte(*js), expr.Segments...)
+		if err != nil {
+			ctx.fail(expr, PhaseMissingField, errMissingField)
+			return nil
+		}
+		switch dt {
+		case jsonparser.Number:
+			v, _ := jsonparser.ParseFloat(val)
+			return v
+		case jsonparser.String:
+			v, _ := jsonparser.ParseString(val)
+			return v
+		case jsonparser.Boolean:
+			v, _ := jsonparser.ParseBoolean(val)
+			return v
+		case jsonparser.Array:
+			return evalJSONArray(val)
+		default:
+			ctx.fail(expr, PhaseType, errUnsupportedFieldType)
+			return nil
+		}
+	default:
+		return nil
+	}
+}
+
+// evalScalarFuncStrict is evalScalarFunc's EvalContext-aware counterpart.
+func evalScalarFuncStrict(expr *Call, js *string, ctx *EvalContext) (interface{}, bool) {
+	switch expr.Name {
+	case "len":
+		if len(expr.Args) != 1 {
+			return nil, true
+		}
+		return scalarLen(EvalStrict(expr.Args[0], js, ctx)), true
+	case "contains":
+		if len(expr.Args) != 2 {
+			return nil, true
+		}
+		list := EvalStrict(expr.Args[0], js, ctx)
+		val := EvalStrict(expr.Args[1], js, ctx)
+		return in_array(val, list), true
+	}
+	return nil, false
+}
+
+// evalBinaryExprStrict resolves both operands through EvalStrict and
+// combines them with the shared applyBinaryOp, flagging a DIV/MOD that
+// bottomed out in NaN as a recorded eval-phase error rather than a value
+// that silently poisons a downstream sum/avg.
+func evalBinaryExprStrict(expr *BinaryExpr, js *string, ctx *EvalContext) interface{} {
+	lhs := EvalStrict(expr.LHS, js, ctx)
+	rhs := EvalStrict(expr.RHS, js, ctx)
+	result := applyBinaryOp(expr.Op, lhs, rhs)
+
+	if f, ok := result.(float64); ok && math.IsNaN(f) && (expr.Op == DIV || expr.Op == MOD) {
+		ctx.fail(expr, PhaseEval, errDivByZero)
+	}
+	return result
+}
+
+// EvalBoolStrict is EvalStrict's EvalBool counterpart.
+func EvalBoolStrict(expr Expr, js *string, ctx *EvalContext) bool {
+	v, _ := EvalStrict(expr, js, ctx).(bool)
+	return v
+}
+
+// evalFCStrict is evalFC's EvalContext-aware counterpart: it feeds each
+// Call's Aggregator the same way, but records a PhaseEval error for an
+// unknown aggregator instead of silently skipping the update.
+func evalFCStrict(expr Expr, js *string, ctx *EvalContext) {
+	switch expr := expr.(type) {
+	case *Call:
+		expr.Count++
+
+		agg, err := expr.Aggregator()
+		if err != nil {
+			ctx.fail(expr, PhaseEval, err)
+			return
+		}
+		agg.Update(EvalStrict(expr.Args[0], js, ctx), time.Now().UnixNano())
+	case *BinaryExpr:
+		evalFCStrict(expr.LHS, js, ctx)
+		evalFCStrict(expr.RHS, js, ctx)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/chenyoufu/jepl"
+	"math"
 	"reflect"
 	"testing"
 )
@@ -216,3 +217,140 @@ func BenchmarkEvalFunctionCalls(b *testing.B) {
 	}
 	fmt.Println(stmt.(*jepl.SelectStatement).EvalMetric())
 }
+
+// Ensure int OP int stays integer for +, -, *, MOD, and that integer
+// addition overflows by wrapping (Go's native int64 semantics) rather
+// than promoting to float64.
+func TestEvalIntegerArithmetic(t *testing.T) {
+	js := "{}"
+	for i, tt := range []struct {
+		lhs, rhs int64
+		op       jepl.Token
+		out      int64
+	}{
+		{lhs: 7, rhs: 3, op: jepl.ADD, out: 10},
+		{lhs: 7, rhs: 3, op: jepl.SUB, out: 4},
+		{lhs: 7, rhs: 3, op: jepl.MUL, out: 21},
+		{lhs: 7, rhs: 3, op: jepl.MOD, out: 1},
+		{lhs: 7, rhs: 3, op: jepl.DIV, out: 2}, // truncates toward zero, stays integer
+		{lhs: math.MaxInt64, rhs: 1, op: jepl.ADD, out: math.MinInt64},
+		{lhs: math.MinInt64, rhs: 1, op: jepl.SUB, out: math.MaxInt64},
+	} {
+		expr := &jepl.BinaryExpr{
+			Op:  tt.op,
+			LHS: &jepl.IntegerLiteral{Val: tt.lhs},
+			RHS: &jepl.IntegerLiteral{Val: tt.rhs},
+		}
+		out := jepl.Eval(expr, &js)
+		if out != tt.out {
+			t.Errorf("%d. %d %s %d: exp=%d, got=%#v", i, tt.lhs, tt.op, tt.rhs, tt.out, out)
+		}
+	}
+}
+
+// Ensure DIV and MOD by a literal zero return a distinguishable NaN
+// sentinel instead of silently returning float64(0), both in the
+// int64 branch and the float64 branch of evalBinaryExpr.
+func TestEvalDivByZero(t *testing.T) {
+	js := "{}"
+	for i, tt := range []struct {
+		lhs jepl.Expr
+		rhs jepl.Expr
+		op  jepl.Token
+	}{
+		{lhs: &jepl.IntegerLiteral{Val: 7}, rhs: &jepl.IntegerLiteral{Val: 0}, op: jepl.DIV},
+		{lhs: &jepl.IntegerLiteral{Val: 7}, rhs: &jepl.IntegerLiteral{Val: 0}, op: jepl.MOD},
+		{lhs: &jepl.NumberLiteral{Val: 7}, rhs: &jepl.NumberLiteral{Val: 0}, op: jepl.DIV},
+	} {
+		expr := &jepl.BinaryExpr{Op: tt.op, LHS: tt.lhs, RHS: tt.rhs}
+		out := jepl.Eval(expr, &js)
+		f, ok := out.(float64)
+		if !ok || !math.IsNaN(f) {
+			t.Errorf("%d. %s by literal zero: exp=NaN, got=%#v", i, tt.op, out)
+		}
+	}
+}
+
+// Ensure ConditionalExpr picks the right branch across mixed
+// numeric/string branch types, through a *VarRef path resolving to
+// nil, and across a nested/chained ternary.
+func TestEvalConditionalExpr(t *testing.T) {
+	js := `{"status": "ok", "temp": 90}`
+	for i, tt := range []struct {
+		expr *jepl.ConditionalExpr
+		out  interface{}
+	}{
+		// Numeric condition, string branches.
+		{
+			expr: &jepl.ConditionalExpr{
+				Cond:      &jepl.BinaryExpr{Op: jepl.GT, LHS: &jepl.VarRef{Val: "temp", Segments: []string{"temp"}}, RHS: &jepl.NumberLiteral{Val: 80}},
+				TrueExpr:  &jepl.StringLiteral{Val: "hot"},
+				FalseExpr: &jepl.StringLiteral{Val: "cold"},
+			},
+			out: "hot",
+		},
+		// String condition, numeric/VarRef branches.
+		{
+			expr: &jepl.ConditionalExpr{
+				Cond:      &jepl.BinaryExpr{Op: jepl.EQ, LHS: &jepl.VarRef{Val: "status", Segments: []string{"status"}}, RHS: &jepl.StringLiteral{Val: "ok"}},
+				TrueExpr:  &jepl.VarRef{Val: "temp", Segments: []string{"temp"}},
+				FalseExpr: &jepl.IntegerLiteral{Val: 0},
+			},
+			out: float64(90),
+		},
+		// A *VarRef Cond that resolves to nil (missing field) is not
+		// true, so the false branch is taken.
+		{
+			expr: &jepl.ConditionalExpr{
+				Cond:      &jepl.VarRef{Val: "missing", Segments: []string{"missing"}},
+				TrueExpr:  &jepl.StringLiteral{Val: "yes"},
+				FalseExpr: &jepl.StringLiteral{Val: "no"},
+			},
+			out: "no",
+		},
+		// Nested/chained ternary: false ? "a" : (true ? "b" : "c").
+		{
+			expr: &jepl.ConditionalExpr{
+				Cond:     &jepl.BooleanLiteral{Val: false},
+				TrueExpr: &jepl.StringLiteral{Val: "a"},
+				FalseExpr: &jepl.ConditionalExpr{
+					Cond:      &jepl.BooleanLiteral{Val: true},
+					TrueExpr:  &jepl.StringLiteral{Val: "b"},
+					FalseExpr: &jepl.StringLiteral{Val: "c"},
+				},
+			},
+			out: "b",
+		},
+	} {
+		out := jepl.Eval(tt.expr, &js)
+		if out != tt.out {
+			t.Errorf("%d. exp=%#v, got=%#v", i, tt.out, out)
+		}
+	}
+}
+
+// Ensure ConditionalExpr only evaluates the selected branch: a *Call
+// in the unused branch must not have its Aggregator read (and reset)
+// as a side effect of evaluating the conditional.
+func TestEvalConditionalExprShortCircuit(t *testing.T) {
+	js := `{"v": 1}`
+	trueCall := &jepl.Call{Name: "sum", Args: []jepl.Expr{&jepl.VarRef{Val: "v", Segments: []string{"v"}}}}
+	falseCall := &jepl.Call{Name: "sum", Args: []jepl.Expr{&jepl.VarRef{Val: "v", Segments: []string{"v"}}}}
+
+	falseAgg, err := falseCall.Aggregator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	falseAgg.Update(float64(42), 0)
+
+	expr := &jepl.ConditionalExpr{
+		Cond:      &jepl.BooleanLiteral{Val: true},
+		TrueExpr:  trueCall,
+		FalseExpr: falseCall,
+	}
+	jepl.Eval(expr, &js)
+
+	if got := falseAgg.Result(); got != float64(42) {
+		t.Errorf("false branch's Aggregator should not have been read/reset, got Result()=%v", got)
+	}
+}
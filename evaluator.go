@@ -0,0 +1,156 @@
+package jepl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrEvaluatorClosed is returned by Feed once the Evaluator's context has
+// been cancelled or Close has been called.
+var ErrEvaluatorClosed = errors.New("jepl: evaluator closed")
+
+// Metrics is the per-group aggregation snapshot returned by Snapshot.
+type Metrics struct {
+	Points Points
+}
+
+// Evaluator incrementally aggregates documents fed through Feed, keeping a
+// per-group accumulator keyed by the tuple of evaluated GROUP BY values,
+// lazily created on first observation, instead of materializing every
+// group (and recloning the statement) up front the way a batch pass over
+// FlatStatByGroup does.
+type Evaluator struct {
+	stmt *SelectStatement
+
+	mu     sync.Mutex
+	groups map[string]*SelectStatement
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	deadlineMu sync.Mutex
+	deadline   *time.Timer
+}
+
+// NewEvaluator returns an Evaluator bound to ctx. Feed starts returning
+// ErrEvaluatorClosed once ctx is done or Close is called.
+func (s *SelectStatement) NewEvaluator(ctx context.Context) *Evaluator {
+	ctx, cancel := context.WithCancel(ctx)
+	return &Evaluator{
+		stmt:   s,
+		groups: make(map[string]*SelectStatement),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// SetDeadline arms a one-shot deadline: if it fires before SetDeadline is
+// called again, the Evaluator is closed. This mirrors the gonet
+// deadlineTimer pattern (a mutex-guarded cancel channel plus
+// time.AfterFunc) so a feed from Kafka or a file tail can be bounded.
+func (e *Evaluator) SetDeadline(d time.Duration) {
+	e.deadlineMu.Lock()
+	defer e.deadlineMu.Unlock()
+
+	if e.deadline != nil {
+		e.deadline.Stop()
+	}
+	e.deadline = time.AfterFunc(d, e.cancel)
+}
+
+// Feed evaluates doc against the statement's WHERE condition and, if it
+// matches, folds it into its group's accumulator.
+func (e *Evaluator) Feed(doc string) error {
+	select {
+	case <-e.ctx.Done():
+		return ErrEvaluatorClosed
+	default:
+	}
+
+	res, ok := Eval(e.stmt.Condition, &doc).(bool)
+	if !ok || !res {
+		return nil
+	}
+
+	key := e.groupKey(&doc)
+
+	e.mu.Lock()
+	st, ok := e.groups[key]
+	if !ok {
+		st = e.stmt.Clone()
+		e.groups[key] = st
+	}
+	e.mu.Unlock()
+
+	st.EvalFunctionCalls(&doc)
+	return nil
+}
+
+// groupKey evaluates the non-time GROUP BY dimensions against doc and
+// joins the resulting values into a stable map key. A time(...)
+// dimension is handled separately by WindowedEvaluator, not folded into
+// this key.
+func (e *Evaluator) groupKey(doc *string) string {
+	dims := e.stmt.TagDimensions()
+	if len(dims) == 0 {
+		return ""
+	}
+	parts := make([]string, len(dims))
+	for i, dimension := range dims {
+		parts[i] = fmt.Sprintf("%v", Eval(dimension.Expr, doc))
+	}
+	return strings.Join(parts, "\x1f")
+}
+
+// Snapshot returns the current aggregated Points for every group, keyed
+// by groupKey. Reading them resets each group's aggregators, so the next
+// Snapshot covers only documents fed after this one.
+func (e *Evaluator) Snapshot() map[string]Metrics {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	out := make(map[string]Metrics, len(e.groups))
+	for k, st := range e.groups {
+		out[k] = Metrics{Points: st.evalMetric()}
+	}
+	return out
+}
+
+// Close releases the Evaluator. Further Feed calls return
+// ErrEvaluatorClosed.
+func (e *Evaluator) Close() error {
+	e.deadlineMu.Lock()
+	if e.deadline != nil {
+		e.deadline.Stop()
+	}
+	e.deadlineMu.Unlock()
+
+	e.cancel()
+	return nil
+}
+
+// FlatStatByGroup divergent multi SelectStatement based on group by clause.
+//
+// It is implemented on top of Evaluator so batch and streaming evaluation
+// share the same grouping logic.
+func (s *SelectStatement) FlatStatByGroup(docs []string) map[string]*SelectStatement {
+	ev := s.NewEvaluator(context.Background())
+	defer ev.Close()
+
+	for _, doc := range docs {
+		_ = ev.Feed(doc)
+	}
+
+	ev.mu.Lock()
+	defer ev.mu.Unlock()
+
+	m := make(map[string]*SelectStatement, len(ev.groups))
+	for k, st := range ev.groups {
+		m[k] = st
+	}
+	return m
+}
@@ -1,50 +1,5 @@
 package jepl
 
-import (
-	"regexp"
-)
-
-//FlatStatByGroup divergent multi SelectStatement based on group by clause
-func (s *SelectStatement) FlatStatByGroup(docs []string) map[string]*SelectStatement {
-	var groups = make(map[string]*BinaryExpr)
-	m := make(map[string]*SelectStatement)
-	for _, doc := range docs {
-		// Dummy root node.
-		root := &BinaryExpr{}
-
-		for _, dimension := range s.Dimensions {
-
-			res := Eval(dimension.Expr, &doc)
-			var lhs Expr
-			switch v := res.(type) {
-			case string:
-				lhs = &StringLiteral{Val: v}
-			case float64:
-				lhs = &NumberLiteral{Val: v}
-			case bool:
-				lhs = &BooleanLiteral{Val: v}
-			default:
-			}
-			rhs := &BinaryExpr{LHS: lhs, Op: EQ, RHS: dimension.Expr}
-
-			if root.LHS == nil {
-				root = &BinaryExpr{LHS: &BooleanLiteral{Val: true}, Op: AND, RHS: rhs}
-			} else {
-				root = &BinaryExpr{LHS: root, Op: AND, RHS: rhs}
-			}
-		}
-		root = &BinaryExpr{LHS: root, Op: AND, RHS: s.Condition}
-		groups[root.String()] = root
-	}
-
-	for k, v := range groups {
-		m[k] = s.Clone()
-		m[k].Condition = v
-	}
-
-	return m
-}
-
 // Clone returns a deep copy of the statement.
 func (s *SelectStatement) Clone() *SelectStatement {
 	clone := *s
@@ -52,6 +7,8 @@ func (s *SelectStatement) Clone() *SelectStatement {
 	clone.Dimensions = make(Dimensions, 0, len(s.Dimensions))
 	clone.Sources = cloneSources(s.Sources)
 	clone.Condition = CloneExpr(s.Condition)
+	clone.TimeField = CloneExpr(s.TimeField)
+	clone.Having = CloneExpr(s.Having)
 
 	for _, f := range s.Fields {
 		clone.Fields = append(clone.Fields, &Field{Expr: CloneExpr(f.Expr), Alias: f.Alias})
@@ -80,6 +37,8 @@ func cloneSource(s Source) Source {
 	case *Measurement:
 		m := &Measurement{Database: s.Database}
 		return m
+	case *SubQuery:
+		return &SubQuery{Statement: s.Statement.Clone(), Alias: s.Alias}
 	default:
 		panic("unreachable")
 	}
@@ -95,20 +54,38 @@ func CloneExpr(expr Expr) Expr {
 		return &BinaryExpr{Op: expr.Op, LHS: CloneExpr(expr.LHS), RHS: CloneExpr(expr.RHS)}
 	case *BooleanLiteral:
 		return &BooleanLiteral{Val: expr.Val}
+	case *BoundParameter:
+		return &BoundParameter{Name: expr.Name}
+	case *CastExpr:
+		return &CastExpr{Expr: CloneExpr(expr.Expr), Type: expr.Type}
 	case *Call:
 		args := make([]Expr, len(expr.Args))
 		for i, arg := range expr.Args {
 			args[i] = CloneExpr(arg)
 		}
-		return &Call{Name: expr.Name, Args: args}
+		return &Call{Name: expr.Name, Args: args, First: expr.First}
+	case *ConditionalExpr:
+		return &ConditionalExpr{
+			Cond:      CloneExpr(expr.Cond),
+			TrueExpr:  CloneExpr(expr.TrueExpr),
+			FalseExpr: CloneExpr(expr.FalseExpr),
+		}
+	case *IndexExpr:
+		return &IndexExpr{Expr: CloneExpr(expr.Expr), Index: CloneExpr(expr.Index)}
 	case *IntegerLiteral:
 		return &IntegerLiteral{Val: expr.Val}
+	case *ListLiteral:
+		vals := make([]interface{}, len(expr.Vals))
+		copy(vals, expr.Vals)
+		return &ListLiteral{Vals: vals}
+	case *SliceExpr:
+		return &SliceExpr{Expr: CloneExpr(expr.Expr), Low: CloneExpr(expr.Low), High: CloneExpr(expr.High)}
 	case *NumberLiteral:
 		return &NumberLiteral{Val: expr.Val}
 	case *ParenExpr:
 		return &ParenExpr{Expr: CloneExpr(expr.Expr)}
 	case *RegexLiteral:
-		return &RegexLiteral{Val: expr.Val}
+		return CloneRegexLiteral(expr)
 	case *StringLiteral:
 		return &StringLiteral{Val: expr.Val}
 	case *VarRef:
@@ -123,10 +100,10 @@ func CloneRegexLiteral(r *RegexLiteral) *RegexLiteral {
 		return nil
 	}
 
-	clone := &RegexLiteral{}
-	if r.Val != nil {
-		clone.Val = regexp.MustCompile(r.Val.String())
-	}
-
-	return clone
+	// r.Val is compiled once, at construction time, and *regexp.Regexp is
+	// safe for concurrent use by multiple goroutines, so a clone can
+	// just share the same compiled pointer instead of paying to
+	// recompile it from its string form on every Clone (e.g. once per
+	// GROUP BY bucket, or once per PreparedStatement.Exec).
+	return &RegexLiteral{Val: r.Val}
 }
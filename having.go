@@ -0,0 +1,45 @@
+package jepl
+
+import "encoding/json"
+
+// EvalHaving evaluates s.Having (if set) against a synthetic doc built
+// from points, keyed by the SELECT field aliases, reusing the same Eval
+// machinery WHERE uses by marshalling the doc to JSON.
+func (s *SelectStatement) EvalHaving(points Points) (bool, error) {
+	if s.Having == nil {
+		return true, nil
+	}
+
+	aliases := s.Fields.AliasNames()
+	doc := make(map[string]interface{}, len(points))
+	for i, p := range points {
+		if i < len(aliases) {
+			doc[aliases[i]] = p.Metric
+		}
+	}
+
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return false, err
+	}
+	js := string(b)
+
+	res, ok := Eval(s.Having, &js).(bool)
+	return ok && res, nil
+}
+
+// FilterHaving drops groups whose HAVING expression evaluates to false,
+// leaving groups unchanged if s.Having is unset.
+func (s *SelectStatement) FilterHaving(groups map[string]Metrics) map[string]Metrics {
+	if s.Having == nil {
+		return groups
+	}
+
+	out := make(map[string]Metrics, len(groups))
+	for k, m := range groups {
+		if ok, _ := s.EvalHaving(m.Points); ok {
+			out[k] = m
+		}
+	}
+	return out
+}
@@ -0,0 +1,70 @@
+package jepl
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+)
+
+// hllPrecision is the number of bits used to select a HyperLogLog
+// register, giving 2^hllPrecision registers (~16KB at the default
+// 14-bit precision) and ~0.8% standard error.
+const hllPrecision = 14
+
+// hyperLogLog estimates the cardinality of a stream of values using
+// Flajolet's HyperLogLog algorithm: each value is hashed, the top
+// precision bits select a register, and the register keeps the position
+// of the leftmost set bit seen so far in the remaining hash (the "rank").
+type hyperLogLog struct {
+	registers [1 << hllPrecision]uint8
+}
+
+func newHyperLogLog() *hyperLogLog {
+	return &hyperLogLog{}
+}
+
+// Add folds v's string representation into the sketch.
+func (h *hyperLogLog) Add(v interface{}) {
+	hsh := fnv.New64a()
+	_, _ = hsh.Write([]byte(toHashString(v)))
+	x := hsh.Sum64()
+
+	idx := x >> (64 - hllPrecision)
+	rest := x<<hllPrecision | (1 << (hllPrecision - 1))
+	rank := uint8(1)
+	for rest&(1<<63) == 0 && rank < 64-hllPrecision {
+		rank++
+		rest <<= 1
+	}
+	if rank > h.registers[idx] {
+		h.registers[idx] = rank
+	}
+}
+
+// Count returns the estimated number of distinct values added so far.
+func (h *hyperLogLog) Count() uint64 {
+	m := float64(uint64(1) << hllPrecision)
+	sum := 0.0
+	zeros := 0
+	for _, r := range h.registers {
+		sum += 1 / math.Pow(2, float64(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+
+	alpha := 0.7213 / (1 + 1.079/m)
+	estimate := alpha * m * m / sum
+
+	if estimate <= 2.5*m && zeros > 0 {
+		return uint64(m * math.Log(m/float64(zeros)))
+	}
+	return uint64(estimate)
+}
+
+func toHashString(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return fmt.Sprintf("%v", v)
+}
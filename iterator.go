@@ -0,0 +1,210 @@
+package jepl
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// FloatIterator, IntegerIterator, StringIterator, and BooleanIterator
+// are the typed leaves of a compiled execution pipeline: each Next call
+// pulls the next (value, event time, GROUP BY tag key) triple through
+// the pipeline, or reports ok=false once the source has drained. This
+// mirrors the iterator model influxql/select.go builds a SELECT's
+// source -> filter -> group -> reduce stages out of.
+type FloatIterator interface {
+	Next() (v float64, ts int64, tags string, ok bool)
+}
+
+// IntegerIterator, StringIterator, and BooleanIterator are defined for
+// forward compatibility with non-numeric SELECT fields; every field
+// JEPL evaluates today is a float64 (see Points), so Compile only ever
+// returns FloatIterators.
+type IntegerIterator interface {
+	Next() (v int64, ts int64, tags string, ok bool)
+}
+
+type StringIterator interface {
+	Next() (v string, ts int64, tags string, ok bool)
+}
+
+type BooleanIterator interface {
+	Next() (v bool, ts int64, tags string, ok bool)
+}
+
+// eventSource is the base stage of a compiled pipeline: a channel-fed
+// queue of raw JSON documents, written to by ExecutionPlan.PushEvent
+// and drained by the stages built on top of it.
+type eventSource struct {
+	docs chan string
+	done chan struct{}
+	once sync.Once
+}
+
+func newEventSource() *eventSource {
+	return &eventSource{docs: make(chan string, 256), done: make(chan struct{})}
+}
+
+func (e *eventSource) push(doc string) { e.docs <- doc }
+
+func (e *eventSource) close() { e.once.Do(func() { close(e.done) }) }
+
+// next pulls the next document, or ok=false once close has been called
+// and every already-pushed document has been drained.
+func (e *eventSource) next() (string, bool) {
+	select {
+	case doc := <-e.docs:
+		return doc, true
+	case <-e.done:
+		select {
+		case doc := <-e.docs:
+			return doc, true
+		default:
+			return "", false
+		}
+	}
+}
+
+// filterIterator wraps an eventSource, only passing through documents
+// that satisfy a SelectStatement's WHERE condition.
+type filterIterator struct {
+	src  *eventSource
+	stmt *SelectStatement
+}
+
+func (f *filterIterator) next() (string, bool) {
+	for {
+		doc, ok := f.src.next()
+		if !ok {
+			return "", false
+		}
+		if res, ok := Eval(f.stmt.Condition, &doc).(bool); ok && res {
+			return doc, true
+		}
+	}
+}
+
+// groupResult is one GROUP BY bucket's reduced Points, tagged by its
+// dimension key (the same \x1f-joined format Evaluator.groupKey uses).
+type groupResult struct {
+	tags   string
+	points Points
+}
+
+// groupIterator folds each filtered document into its GROUP BY
+// bucket's Call aggregators (one *SelectStatement Clone per tag key),
+// then drains every bucket's reduced Points once the source closes.
+// The fold only runs once no matter how many field iterators read from
+// it: results() memoizes the drain so every SELECT field sees the same
+// groups in the same order.
+type groupIterator struct {
+	filter  *filterIterator
+	stmt    *SelectStatement
+	buckets map[string]*SelectStatement
+	drained []groupResult
+	built   bool
+}
+
+func newGroupIterator(filter *filterIterator, stmt *SelectStatement) *groupIterator {
+	return &groupIterator{filter: filter, stmt: stmt, buckets: make(map[string]*SelectStatement)}
+}
+
+func (g *groupIterator) groupKey(doc *string) string {
+	dims := g.stmt.TagDimensions()
+	if len(dims) == 0 {
+		return ""
+	}
+	parts := make([]string, len(dims))
+	for i, d := range dims {
+		parts[i] = fmt.Sprintf("%v", Eval(d.Expr, doc))
+	}
+	return strings.Join(parts, "\x1f")
+}
+
+func (g *groupIterator) results() []groupResult {
+	if g.built {
+		return g.drained
+	}
+	for {
+		doc, ok := g.filter.next()
+		if !ok {
+			break
+		}
+		key := g.groupKey(&doc)
+		st, ok := g.buckets[key]
+		if !ok {
+			st = g.stmt.Clone()
+			g.buckets[key] = st
+		}
+		st.EvalFunctionCalls(&doc)
+	}
+	for key, st := range g.buckets {
+		g.drained = append(g.drained, groupResult{tags: key, points: st.evalMetric()})
+	}
+	g.built = true
+	return g.drained
+}
+
+// floatFieldIterator adapts a groupIterator into a FloatIterator over
+// one SELECT field's reduced value, keeping its own cursor into the
+// shared, memoized group results.
+type floatFieldIterator struct {
+	group *groupIterator
+	field int
+	pos   int
+}
+
+func (it *floatFieldIterator) Next() (v float64, ts int64, tags string, ok bool) {
+	results := it.group.results()
+	if it.pos >= len(results) {
+		return 0, 0, "", false
+	}
+	r := results[it.pos]
+	it.pos++
+	if it.field >= len(r.points) {
+		return 0, 0, r.tags, false
+	}
+	p := r.points[it.field]
+	return p.Metric, p.TS, r.tags, true
+}
+
+// ExecutionPlan is a compiled SelectStatement: an eventSource feeding a
+// WHERE filter and a GROUP BY grouping stage, with one FloatIterator
+// per SELECT field drawing from it. PushEvent feeds the source and
+// Fields drains the typed iterators, so the same plan can evaluate a
+// stream of events. Each event still goes through Eval for the WHERE
+// filter and EvalFunctionCalls for the SELECT fields.
+type ExecutionPlan struct {
+	stmt   *SelectStatement
+	source *eventSource
+	group  *groupIterator
+}
+
+// Compile builds an ExecutionPlan for s. schema is accepted for
+// forward compatibility with a typed field schema; it is unused today
+// since every JEPL field evaluates to a float64 Point.
+func (s *SelectStatement) Compile(schema string) (*ExecutionPlan, error) {
+	src := newEventSource()
+	filter := &filterIterator{src: src, stmt: s}
+	return &ExecutionPlan{
+		stmt:   s,
+		source: src,
+		group:  newGroupIterator(filter, s),
+	}, nil
+}
+
+// PushEvent feeds one raw JSON document into the plan's source stage.
+func (p *ExecutionPlan) PushEvent(event string) { p.source.push(event) }
+
+// Close signals that no more events will be pushed, letting Fields'
+// iterators drain their final GROUP BY buckets.
+func (p *ExecutionPlan) Close() { p.source.close() }
+
+// Fields returns one FloatIterator per SELECT field, in field order.
+func (p *ExecutionPlan) Fields() []FloatIterator {
+	its := make([]FloatIterator, len(p.stmt.Fields))
+	for i := range p.stmt.Fields {
+		its[i] = &floatFieldIterator{group: p.group, field: i}
+	}
+	return its
+}
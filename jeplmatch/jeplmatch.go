@@ -0,0 +1,125 @@
+// Package jeplmatch matches JEPL expression trees against patterns
+// written in JEPL's own syntax, such as `sum($x) > $n` or
+// `avg($x) - avg($y) > $z`, binding each `$metavariable` to the concrete
+// VarRef/Literal/Expr node it matched. It gives alerting-rule authors a
+// way to detect, rewrite, or forbid particular query shapes without
+// hand-rolling type switches over the AST, the same way gogrep matches
+// Go ASTs against Go-syntax patterns.
+package jeplmatch
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/chenyoufu/jepl"
+)
+
+// metaPrefix is substituted for every "$name" metavariable before the
+// pattern text is handed to the real JEPL parser, so the pattern parses
+// as ordinary JEPL with sentinel identifiers standing in for holes.
+const metaPrefix = "__jeplmatch_"
+
+var metavarRe = regexp.MustCompile(`\$([A-Za-z_][A-Za-z0-9_]*)`)
+
+// Bindings maps each metavariable name (without its leading "$") to the
+// node it was unified with.
+type Bindings map[string]jepl.Node
+
+// Pattern is a compiled match pattern, ready to be matched against AST
+// nodes with Match.
+type Pattern struct {
+	expr     jepl.Expr
+	metavars map[string]struct{}
+}
+
+// Compile parses pattern as a JEPL expression, treating any `$name`
+// token as a metavariable that Match will bind rather than require a
+// literal match for.
+func Compile(pattern string) (*Pattern, error) {
+	metavars := make(map[string]struct{})
+	substituted := metavarRe.ReplaceAllStringFunc(pattern, func(tok string) string {
+		name := tok[1:]
+		metavars[name] = struct{}{}
+		return metaPrefix + name
+	})
+
+	expr, err := jepl.NewParser(strings.NewReader(substituted)).ParseExpr()
+	if err != nil {
+		return nil, fmt.Errorf("jeplmatch: parsing pattern %q: %w", pattern, err)
+	}
+
+	return &Pattern{expr: expr, metavars: metavars}, nil
+}
+
+// Vars returns the metavariable names (without their leading "$") that
+// occur in the pattern.
+func (p *Pattern) Vars() []string {
+	vars := make([]string, 0, len(p.metavars))
+	for name := range p.metavars {
+		vars = append(vars, name)
+	}
+	return vars
+}
+
+// Match attempts to unify the pattern against node, which must be an
+// Expr (or a VarRef/Call/BinaryExpr/ParenExpr/literal within one, since
+// SelectStatement fields are themselves Expr trees). It returns the
+// bindings produced and whether the match succeeded.
+func (p *Pattern) Match(node jepl.Node) (Bindings, bool) {
+	expr, ok := node.(jepl.Expr)
+	if !ok {
+		return nil, false
+	}
+	b := make(Bindings)
+	if !unify(p.expr, expr, b) {
+		return nil, false
+	}
+	return b, true
+}
+
+// unify recurses over pattern and target in lockstep: a metavariable
+// VarRef binds on first sight and must unify with the same node
+// (structurally) on reuse; a BinaryExpr requires an equal Op; a Call
+// requires an equal Name and argument count; ParenExpr is transparent;
+// everything else falls back to structural equality.
+func unify(pattern, target jepl.Expr, b Bindings) bool {
+	if pe, ok := pattern.(*jepl.ParenExpr); ok {
+		return unify(pe.Expr, target, b)
+	}
+	if te, ok := target.(*jepl.ParenExpr); ok {
+		return unify(pattern, te.Expr, b)
+	}
+
+	if ref, ok := pattern.(*jepl.VarRef); ok && strings.HasPrefix(ref.Val, metaPrefix) {
+		name := strings.TrimPrefix(ref.Val, metaPrefix)
+		if bound, ok := b[name]; ok {
+			return reflect.DeepEqual(bound, jepl.Node(target))
+		}
+		b[name] = target
+		return true
+	}
+
+	switch p := pattern.(type) {
+	case *jepl.BinaryExpr:
+		t, ok := target.(*jepl.BinaryExpr)
+		if !ok || p.Op != t.Op {
+			return false
+		}
+		return unify(p.LHS, t.LHS, b) && unify(p.RHS, t.RHS, b)
+	case *jepl.Call:
+		t, ok := target.(*jepl.Call)
+		if !ok || p.Name != t.Name || len(p.Args) != len(t.Args) {
+			return false
+		}
+		for i := range p.Args {
+			if !unify(p.Args[i], t.Args[i], b) {
+				return false
+			}
+		}
+		return true
+	default:
+		return reflect.DeepEqual(pattern, target)
+	}
+}
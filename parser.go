@@ -0,0 +1,393 @@
+package jepl
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ParseError describes a syntax error encountered while parsing. It
+// mirrors the position-aware diagnostics influxql-style parsers give,
+// pairing a Found/Expected pair with the offending token's Pos.
+type ParseError struct {
+	Message  string
+	Found    string
+	Expected []string
+	Pos      Pos
+}
+
+// Error returns the formatted error string.
+func (e *ParseError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("%s at line %d, char %d", e.Message, e.Pos.Line+1, e.Pos.Char+1)
+	}
+	return fmt.Sprintf("found %s, expected %s at line %d, char %d", e.Found, strings.Join(e.Expected, ", "), e.Pos.Line+1, e.Pos.Char+1)
+}
+
+// newParseError returns a ParseError reporting that found was seen where
+// one of expected was required.
+func newParseError(found string, expected []string, pos Pos) error {
+	return &ParseError{Found: found, Expected: expected, Pos: pos}
+}
+
+// Parser represents a parser for jepl SELECT statements and expressions.
+type Parser struct {
+	s   *Scanner
+	buf struct {
+		tok Token
+		pos Pos
+		lit string
+		n   int // buffered token count, 0 or 1
+	}
+}
+
+// NewParser returns a new instance of Parser reading from r.
+func NewParser(r io.Reader) *Parser {
+	return &Parser{s: NewScanner(r)}
+}
+
+// ParseStatement parses s into a Statement.
+func ParseStatement(s string) (Statement, error) {
+	return NewParser(strings.NewReader(s)).ParseStatement()
+}
+
+// scan returns the next token, buffering it so a single call to unscan
+// can push it back.
+func (p *Parser) scan() (tok Token, pos Pos, lit string) {
+	if p.buf.n != 0 {
+		p.buf.n = 0
+		return p.buf.tok, p.buf.pos, p.buf.lit
+	}
+
+	tok, pos, lit = p.s.Scan()
+	p.buf.tok, p.buf.pos, p.buf.lit = tok, pos, lit
+	return
+}
+
+// unscan pushes the last-scanned token back onto the parser.
+func (p *Parser) unscan() { p.buf.n = 1 }
+
+// scanIgnoreWhitespace scans the next non-whitespace token.
+func (p *Parser) scanIgnoreWhitespace() (tok Token, pos Pos, lit string) {
+	for {
+		if tok, pos, lit = p.scan(); tok != WS {
+			return
+		}
+	}
+}
+
+// parseIdent scans an identifier, returning its literal text.
+func (p *Parser) parseIdent() (string, error) {
+	tok, pos, lit := p.scanIgnoreWhitespace()
+	if tok != IDENT {
+		return "", newParseError(tokstr(tok, lit), []string{"identifier"}, pos)
+	}
+	return lit, nil
+}
+
+// ParseStatement parses a SELECT statement and ensures no trailing tokens
+// (other than EOF) remain.
+func (p *Parser) ParseStatement() (Statement, error) {
+	tok, pos, lit := p.scanIgnoreWhitespace()
+	if tok != SELECT {
+		return nil, newParseError(tokstr(tok, lit), []string{"SELECT"}, pos)
+	}
+
+	stmt, err := p.parseSelectStatement()
+	if err != nil {
+		return nil, err
+	}
+
+	if tok, pos, lit := p.scanIgnoreWhitespace(); tok != EOF {
+		return nil, newParseError(tokstr(tok, lit), []string{"EOF"}, pos)
+	}
+
+	return stmt, nil
+}
+
+// parseSelectStatement parses the body of a SELECT statement, assuming
+// the leading SELECT keyword has already been consumed.
+func (p *Parser) parseSelectStatement() (*SelectStatement, error) {
+	stmt := &SelectStatement{}
+
+	fields, err := p.parseFields()
+	if err != nil {
+		return nil, err
+	}
+	stmt.Fields = fields
+
+	if tok, _, _ := p.scanIgnoreWhitespace(); tok == FROM {
+		sources, err := p.parseSources()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Sources = sources
+	} else {
+		p.unscan()
+	}
+
+	if tok, _, _ := p.scanIgnoreWhitespace(); tok == WHERE {
+		cond, err := p.ParseExpr()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Condition = cond
+	} else {
+		p.unscan()
+	}
+
+	if tok, _, _ := p.scanIgnoreWhitespace(); tok == GROUP {
+		if tok2, pos2, lit2 := p.scanIgnoreWhitespace(); tok2 != BY {
+			return nil, newParseError(tokstr(tok2, lit2), []string{"BY"}, pos2)
+		}
+		dims, err := p.parseDimensions()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Dimensions = dims
+	} else {
+		p.unscan()
+	}
+
+	if err := stmt.validate(); err != nil {
+		return nil, err
+	}
+
+	return stmt, nil
+}
+
+// parseFields parses a comma-separated list of SELECT fields.
+func (p *Parser) parseFields() (Fields, error) {
+	var fields Fields
+	for {
+		f, err := p.parseField()
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, f)
+
+		if tok, _, _ := p.scanIgnoreWhitespace(); tok != COMMA {
+			p.unscan()
+			break
+		}
+	}
+	return fields, nil
+}
+
+// parseField parses a single SELECT field, with an optional AS alias.
+func (p *Parser) parseField() (*Field, error) {
+	expr, err := p.ParseExpr()
+	if err != nil {
+		return nil, err
+	}
+
+	f := &Field{Expr: expr}
+
+	if tok, _, _ := p.scanIgnoreWhitespace(); tok == AS {
+		alias, err := p.parseIdent()
+		if err != nil {
+			return nil, err
+		}
+		f.Alias = alias
+	} else {
+		p.unscan()
+	}
+
+	return f, nil
+}
+
+// parseSources parses a comma-separated list of measurement names
+// following FROM.
+func (p *Parser) parseSources() (Sources, error) {
+	var sources Sources
+	for {
+		ident, err := p.parseIdent()
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, &Measurement{Database: ident})
+
+		if tok, _, _ := p.scanIgnoreWhitespace(); tok != COMMA {
+			p.unscan()
+			break
+		}
+	}
+	return sources, nil
+}
+
+// parseDimensions parses a comma-separated list of GROUP BY dimensions.
+func (p *Parser) parseDimensions() (Dimensions, error) {
+	var dims Dimensions
+	for {
+		expr, err := p.parseUnaryExpr()
+		if err != nil {
+			return nil, err
+		}
+		dims = append(dims, &Dimension{Expr: expr})
+
+		if tok, _, _ := p.scanIgnoreWhitespace(); tok != COMMA {
+			p.unscan()
+			break
+		}
+	}
+	return dims, nil
+}
+
+// ParseExpr parses an expression.
+func (p *Parser) ParseExpr() (Expr, error) {
+	return p.parseBinaryExpr(1)
+}
+
+// parseBinaryExpr parses a binary expression using precedence climbing;
+// only operators whose precedence is >= minPrec are consumed at this
+// level, deferring lower-precedence operators to the caller.
+func (p *Parser) parseBinaryExpr(minPrec int) (Expr, error) {
+	lhs, err := p.parseUnaryExpr()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		op, pos, lit := p.scanIgnoreWhitespace()
+		prec := op.Precedence()
+		switch op {
+		case MOD:
+			prec = MUL.Precedence()
+		case CONTAINS:
+			prec = EQ.Precedence()
+		}
+		if !op.isOperator() || prec < minPrec {
+			p.unscan()
+			return lhs, nil
+		}
+		_ = lit
+		_ = pos
+
+		var rhs Expr
+		if op == EQREGEX || op == NEQREGEX {
+			rhs, err = p.parseRegex()
+		} else {
+			rhs, err = p.parseBinaryExpr(prec + 1)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		lhs = &BinaryExpr{Op: op, LHS: lhs, RHS: rhs}
+	}
+}
+
+// parseRegex scans a regex literal immediately following a =~/!~
+// operator, skipping any whitespace before the opening `/`.
+func (p *Parser) parseRegex() (Expr, error) {
+	p.s.skipWhitespace()
+
+	tok, pos, lit := p.s.ScanRegex()
+	if tok == BADREGEX {
+		return nil, newParseError("bad regex", []string{"regex"}, pos)
+	}
+
+	re, err := regexp.Compile(lit)
+	if err != nil {
+		return nil, &ParseError{Message: fmt.Sprintf("invalid regular expression: %s", err), Pos: pos}
+	}
+	return &RegexLiteral{Val: re}, nil
+}
+
+// parseUnaryExpr parses a primary expression: a literal, a (possibly
+// dotted) variable reference, a function call, or a parenthesized
+// expression.
+func (p *Parser) parseUnaryExpr() (Expr, error) {
+	tok, pos, lit := p.scanIgnoreWhitespace()
+	switch tok {
+	case IDENT:
+		return p.parseIdentOrCall(lit)
+	case STRING:
+		return &StringLiteral{Val: lit}, nil
+	case NUMBER:
+		v, err := strconv.ParseFloat(lit, 64)
+		if err != nil {
+			return nil, &ParseError{Message: fmt.Sprintf("unable to parse number: %s", lit), Pos: pos}
+		}
+		return &NumberLiteral{Val: v}, nil
+	case INTEGER:
+		v, err := strconv.ParseInt(lit, 10, 64)
+		if err != nil {
+			// Too large for an int64; fall back to a float.
+			v2, _ := strconv.ParseFloat(lit, 64)
+			return &NumberLiteral{Val: v2}, nil
+		}
+		return &IntegerLiteral{Val: v}, nil
+	case TRUE:
+		return &BooleanLiteral{Val: true}, nil
+	case FALSE:
+		return &BooleanLiteral{Val: false}, nil
+	case LPAREN:
+		expr, err := p.parseBinaryExpr(1)
+		if err != nil {
+			return nil, err
+		}
+		if tok2, pos2, lit2 := p.scanIgnoreWhitespace(); tok2 != RPAREN {
+			return nil, newParseError(tokstr(tok2, lit2), []string{")"}, pos2)
+		}
+		return &ParenExpr{Expr: expr}, nil
+	}
+
+	return nil, newParseError(tokstr(tok, lit), []string{"identifier", "string", "number", "bool"}, pos)
+}
+
+// parseIdentOrCall parses either a function call (name immediately
+// followed by parentheses) or a bare, possibly dotted, variable
+// reference.
+func (p *Parser) parseIdentOrCall(name string) (Expr, error) {
+	if tok, _, _ := p.scan(); tok == LPAREN {
+		return p.parseCall(name)
+	}
+	p.unscan()
+
+	segments := []string{name}
+	for {
+		if tok, _, _ := p.scan(); tok != DOT {
+			p.unscan()
+			break
+		}
+
+		tok2, pos2, lit2 := p.scan()
+		if tok2 != IDENT {
+			return nil, newParseError(tokstr(tok2, lit2), []string{"identifier"}, pos2)
+		}
+		segments = append(segments, lit2)
+	}
+
+	return &VarRef{Val: strings.Join(segments, "."), Segments: segments}, nil
+}
+
+// parseCall parses a function call's argument list, assuming name and
+// the opening paren have already been consumed.
+func (p *Parser) parseCall(name string) (Expr, error) {
+	call := &Call{Name: name, First: true}
+
+	if tok, _, _ := p.scanIgnoreWhitespace(); tok == RPAREN {
+		return call, nil
+	}
+	p.unscan()
+
+	for {
+		arg, err := p.ParseExpr()
+		if err != nil {
+			return nil, err
+		}
+		call.Args = append(call.Args, arg)
+
+		tok, pos, lit := p.scanIgnoreWhitespace()
+		if tok == RPAREN {
+			break
+		} else if tok != COMMA {
+			return nil, newParseError(tokstr(tok, lit), []string{",", ")"}, pos)
+		}
+	}
+
+	return call, nil
+}
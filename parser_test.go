@@ -100,6 +100,41 @@ func TestParseSelectStatement(t *testing.T) {
 	}
 }
 
+// Ensure the parser validates argument counts for the aggregate
+// functions added alongside percentile/stddev/first/last/
+// distinct_count (topk and percentile take 2 args; the rest, like
+// sum/avg, take exactly 1), the same way it already does for count().
+func TestParseSelectStatementAggregates(t *testing.T) {
+	var tests = []struct {
+		s   string
+		err string
+	}{
+		// Errors
+		{s: `select percentile(x) from foo`, err: `invalid number of arguments for percentile, expected 2, got 1`},
+		{s: `select percentile(x, 50, 99) from foo`, err: `invalid number of arguments for percentile, expected 2, got 3`},
+		{s: `select topk(x) from foo`, err: `invalid number of arguments for topk, expected 2, got 1`},
+		{s: `select stddev(x, y) from foo`, err: `invalid number of arguments for stddev, expected 1, got 2`},
+		{s: `select distinct_count() from foo`, err: `invalid number of arguments for distinct_count, expected 1, got 0`},
+		{s: `select first(x, y) from foo`, err: `invalid number of arguments for first, expected 1, got 2`},
+
+		// Correct
+		{s: `select percentile(x, 95) from foo`, err: ``},
+		{s: `select topk(x, 10) from foo`, err: ``},
+		{s: `select stddev(x) from foo`, err: ``},
+		{s: `select distinct_count(x) from foo`, err: ``},
+		{s: `select first(x) from foo`, err: ``},
+		{s: `select last(x) from foo`, err: ``},
+	}
+	for i, tt := range tests {
+		p := jepl.NewParser(strings.NewReader(tt.s))
+		_, err := p.ParseStatement()
+
+		if !reflect.DeepEqual(tt.err, errstring(err)) {
+			t.Errorf("%d. %q: error mismatch:\n  exp=%s\n  got=%s\n\n", i, tt.s, tt.err, err)
+		}
+	}
+}
+
 // Ensure the parser can parse expressions into an AST.
 func TestParser_ParseExpr(t *testing.T) {
 	var tests = []struct {
@@ -372,3 +407,28 @@ func BenchmarkParseStatement2(b *testing.B) {
 	}
 	b.SetBytes(int64(len(s)))
 }
+
+// BenchmarkCloneRegexLiteral clones a representative `foo =~ /.../ AND
+// bar !~ /.../` filter repeatedly, the way FlatStatByGroup clones a
+// SelectStatement once per GROUP BY bucket. RegexLiteral.Val is
+// compiled once up front; CloneExpr should only ever copy that
+// compiled *regexp.Regexp pointer, never recompile it.
+func BenchmarkCloneRegexLiteral(b *testing.B) {
+	cond := &jepl.BinaryExpr{
+		Op: jepl.AND,
+		LHS: &jepl.BinaryExpr{
+			Op:  jepl.EQREGEX,
+			LHS: &jepl.VarRef{Val: "foo", Segments: []string{"foo"}},
+			RHS: &jepl.RegexLiteral{Val: regexp.MustCompile(`^[a-z]+\d{3}$`)},
+		},
+		RHS: &jepl.BinaryExpr{
+			Op:  jepl.NEQREGEX,
+			LHS: &jepl.VarRef{Val: "bar", Segments: []string{"bar"}},
+			RHS: &jepl.RegexLiteral{Val: regexp.MustCompile(`^(foo|bar|baz)$`)},
+		},
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = jepl.CloneExpr(cond)
+	}
+}
@@ -0,0 +1,371 @@
+package jepl
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Param is one bound parameter slot inside a prepared query, written as
+// a bare "?" (positional, bound by its string index "0", "1", ...) or
+// ":name" (named) in place of an ordinary literal.
+type Param struct {
+	Name string
+}
+
+// PreparedStatement is a parsed, canonicalized query plan. Two queries
+// that canonicalize to the same shape (same commutative-operand order,
+// aliases stripped) share a Hash, so a PreparedStatementCache can serve
+// one plan for many textually-different but semantically-equal
+// queries instead of re-parsing and re-walking each one.
+type PreparedStatement struct {
+	stmt   *SelectStatement
+	Hash   string
+	Params []Param
+}
+
+// Prepare parses query, canonicalizes its AST, hashes the canonical
+// form, and extracts its "?"/":name" parameter slots in the order they
+// appear in the canonical form, which is not necessarily source order.
+func Prepare(query string) (*PreparedStatement, error) {
+	stmt, err := ParseStatement(query)
+	if err != nil {
+		return nil, err
+	}
+	selectStmt, ok := stmt.(*SelectStatement)
+	if !ok {
+		return nil, fmt.Errorf("jepl: Prepare only supports SELECT statements")
+	}
+
+	canon := canonicalize(selectStmt)
+	ps := &PreparedStatement{
+		stmt: canon,
+		Hash: hashStatement(canon),
+	}
+	WalkFunc(canon, func(n Node) {
+		ref, ok := n.(*VarRef)
+		if !ok {
+			return
+		}
+		if name, ok := paramName(ref.Val); ok {
+			ps.Params = append(ps.Params, Param{Name: name})
+		}
+	})
+	return ps, nil
+}
+
+// paramName reports whether val names a bound parameter ("?" or
+// ":name"), returning the key Exec's params map is looked up by.
+func paramName(val string) (string, bool) {
+	if val == "?" {
+		return "", true
+	}
+	if strings.HasPrefix(val, ":") && len(val) > 1 {
+		return val[1:], true
+	}
+	return "", false
+}
+
+// commutativeOps are the BinaryExpr operators canonicalize is free to
+// reorder, since swapping their operands never changes the result.
+var commutativeOps = map[Token]bool{
+	ADD: true,
+	MUL: true,
+	AND: true,
+	OR:  true,
+	EQ:  true,
+	NEQ: true,
+}
+
+// canonicalize returns a clone of s with every Field alias stripped and
+// every commutative BinaryExpr's operands ordered by their string form,
+// so two queries with the same shape but differently-ordered operands
+// or aliases produce the same Hash.
+func canonicalize(s *SelectStatement) *SelectStatement {
+	clone := s.Clone()
+	for _, f := range clone.Fields {
+		f.Alias = ""
+		f.Expr = canonicalizeExpr(f.Expr)
+	}
+	clone.Condition = canonicalizeExpr(clone.Condition)
+	return clone
+}
+
+func canonicalizeExpr(expr Expr) Expr {
+	switch e := expr.(type) {
+	case *BinaryExpr:
+		e.LHS = canonicalizeExpr(e.LHS)
+		e.RHS = canonicalizeExpr(e.RHS)
+		if commutativeOps[e.Op] && e.LHS.String() > e.RHS.String() {
+			e.LHS, e.RHS = e.RHS, e.LHS
+		}
+		return e
+	case *ParenExpr:
+		e.Expr = canonicalizeExpr(e.Expr)
+		return e
+	case *Call:
+		for i, a := range e.Args {
+			e.Args[i] = canonicalizeExpr(a)
+		}
+		return e
+	case *ConditionalExpr:
+		e.Cond = canonicalizeExpr(e.Cond)
+		e.TrueExpr = canonicalizeExpr(e.TrueExpr)
+		e.FalseExpr = canonicalizeExpr(e.FalseExpr)
+		return e
+	default:
+		return expr
+	}
+}
+
+// hashStatement returns a stable hex-encoded hash of the canonical
+// form's string representation.
+func hashStatement(s *SelectStatement) string {
+	sum := sha256.Sum256([]byte(s.String()))
+	return hex.EncodeToString(sum[:])
+}
+
+// Exec binds params into the prepared plan's placeholders, evaluates
+// the result against event, and returns the aggregated Points. Each
+// Exec gets its own Clone of the canonical statement (and so its own
+// per-Call Aggregator state, via Call.Aggregator), so concurrent Execs
+// of the same PreparedStatement don't share accumulators.
+func (ps *PreparedStatement) Exec(params map[string]interface{}, event map[string]interface{}) (Points, error) {
+	st := ps.stmt.Clone()
+	pos := 0
+	st.Condition = bindParams(st.Condition, params, &pos)
+	for _, f := range st.Fields {
+		f.Expr = bindParams(f.Expr, params, &pos)
+	}
+
+	doc, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+	js := string(doc)
+
+	if res, ok := Eval(st.Condition, &js).(bool); !ok || !res {
+		return Points{}, nil
+	}
+	st.EvalFunctionCalls(&js)
+	return st.evalMetric(), nil
+}
+
+// bindParams returns a copy of expr with every "?"/":name" VarRef
+// replaced by a literal built from params, advancing pos for each
+// positional "?" encountered (looked up as params["0"], params["1"], ...).
+func bindParams(expr Expr, params map[string]interface{}, pos *int) Expr {
+	switch e := expr.(type) {
+	case *BinaryExpr:
+		return &BinaryExpr{Op: e.Op, LHS: bindParams(e.LHS, params, pos), RHS: bindParams(e.RHS, params, pos)}
+	case *ParenExpr:
+		return &ParenExpr{Expr: bindParams(e.Expr, params, pos)}
+	case *Call:
+		args := make([]Expr, len(e.Args))
+		for i, a := range e.Args {
+			args[i] = bindParams(a, params, pos)
+		}
+		return &Call{Name: e.Name, Args: args}
+	case *ConditionalExpr:
+		return &ConditionalExpr{
+			Cond:      bindParams(e.Cond, params, pos),
+			TrueExpr:  bindParams(e.TrueExpr, params, pos),
+			FalseExpr: bindParams(e.FalseExpr, params, pos),
+		}
+	case *VarRef:
+		if e.Val == "?" {
+			v := params[strconv.Itoa(*pos)]
+			*pos++
+			return literalFor(v)
+		}
+		if name, ok := paramName(e.Val); ok {
+			return literalFor(params[name])
+		}
+		return e
+	default:
+		return expr
+	}
+}
+
+// BindParameters substitutes every BoundParameter ("$name") in s with a
+// literal built from params, returning a new *SelectStatement (s itself
+// is left unmodified). Unlike Exec's bindParams above, used for the
+// older "?"/":name" VarRef-based convention, this is strict: a name with
+// no entry in params, or a value whose Go type literalFor can't
+// represent as a literal, is reported as an error instead of silently
+// falling back to nil or a formatted string.
+func (s *SelectStatement) BindParameters(params map[string]interface{}) (*SelectStatement, error) {
+	var errs []string
+	for _, name := range s.NamesInParameters() {
+		v, ok := params[name]
+		if !ok {
+			errs = append(errs, fmt.Sprintf("unbound parameter $%s", name))
+			continue
+		}
+		if !literalRepresentable(v) {
+			errs = append(errs, fmt.Sprintf("parameter $%s: unsupported type %T", name, v))
+		}
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("jepl: BindParameters: %s", strings.Join(errs, "; "))
+	}
+
+	clone := s.Clone()
+	clone.Condition = bindBoundParams(clone.Condition, params)
+	for _, f := range clone.Fields {
+		f.Expr = bindBoundParams(f.Expr, params)
+	}
+	return clone, nil
+}
+
+// literalRepresentable reports whether v is one of the Go types
+// literalFor knows how to turn into an Expr literal.
+func literalRepresentable(v interface{}) bool {
+	switch v.(type) {
+	case string, bool, int, int64, float64:
+		return true
+	default:
+		return false
+	}
+}
+
+// bindBoundParams returns a copy of expr with every BoundParameter
+// replaced by a literal from params. Callers go through BindParameters,
+// which validates params against NamesInParameters first, so every
+// *BoundParameter reached here is guaranteed to have a representable
+// entry in params.
+func bindBoundParams(expr Expr, params map[string]interface{}) Expr {
+	switch e := expr.(type) {
+	case *BinaryExpr:
+		return &BinaryExpr{Op: e.Op, LHS: bindBoundParams(e.LHS, params), RHS: bindBoundParams(e.RHS, params)}
+	case *ParenExpr:
+		return &ParenExpr{Expr: bindBoundParams(e.Expr, params)}
+	case *Call:
+		args := make([]Expr, len(e.Args))
+		for i, a := range e.Args {
+			args[i] = bindBoundParams(a, params)
+		}
+		return &Call{Name: e.Name, Args: args}
+	case *ConditionalExpr:
+		return &ConditionalExpr{
+			Cond:      bindBoundParams(e.Cond, params),
+			TrueExpr:  bindBoundParams(e.TrueExpr, params),
+			FalseExpr: bindBoundParams(e.FalseExpr, params),
+		}
+	case *BoundParameter:
+		return literalFor(params[e.Name])
+	default:
+		return expr
+	}
+}
+
+// literalFor converts a bound parameter value into the Expr literal
+// type Eval expects in its place.
+func literalFor(v interface{}) Expr {
+	switch v := v.(type) {
+	case string:
+		return &StringLiteral{Val: v}
+	case bool:
+		return &BooleanLiteral{Val: v}
+	case int:
+		return &IntegerLiteral{Val: int64(v)}
+	case int64:
+		return &IntegerLiteral{Val: v}
+	case float64:
+		return &NumberLiteral{Val: v}
+	default:
+		return &StringLiteral{Val: fmt.Sprintf("%v", v)}
+	}
+}
+
+// PreparedStatementCache is an LRU of PreparedStatements keyed by their
+// canonical Hash, so repeated Prepare calls for semantically-equal
+// queries share a single plan.
+type PreparedStatementCache struct {
+	capacity int
+
+	mu    sync.Mutex
+	order []string
+	byKey map[string]*PreparedStatement
+}
+
+// NewPreparedStatementCache returns an empty cache holding at most
+// capacity plans, evicting the least-recently-used one once full.
+func NewPreparedStatementCache(capacity int) *PreparedStatementCache {
+	return &PreparedStatementCache{
+		capacity: capacity,
+		byKey:    make(map[string]*PreparedStatement),
+	}
+}
+
+// Prepare returns the cached plan for query's canonical shape if one
+// exists, preparing and caching a new one otherwise.
+func (c *PreparedStatementCache) Prepare(query string) (*PreparedStatement, error) {
+	ps, err := Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if cached, ok := c.byKey[ps.Hash]; ok {
+		c.touch(ps.Hash)
+		return cached, nil
+	}
+
+	c.byKey[ps.Hash] = ps
+	c.order = append(c.order, ps.Hash)
+	if c.capacity > 0 && len(c.order) > c.capacity {
+		oldest := c.order[0]
+		c.order = c.order[1:]
+		delete(c.byKey, oldest)
+	}
+	return ps, nil
+}
+
+// touch moves hash to the most-recently-used end of the eviction
+// order. c.mu must be held.
+func (c *PreparedStatementCache) touch(hash string) {
+	for i, h := range c.order {
+		if h == hash {
+			c.order = append(c.order[:i], c.order[i+1:]...)
+			break
+		}
+	}
+	c.order = append(c.order, hash)
+}
+
+// Invalidate evicts every cached plan that reads from a source whose
+// name starts with prefix, for use when a measurement's schema or
+// config changes.
+func (c *PreparedStatementCache) Invalidate(prefix string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for hash, ps := range c.byKey {
+		for _, src := range ps.stmt.Sources.Names() {
+			if strings.HasPrefix(src, prefix) {
+				delete(c.byKey, hash)
+				break
+			}
+		}
+	}
+	c.rebuildOrder()
+}
+
+// rebuildOrder drops any order entries whose plan was evicted by
+// Invalidate. c.mu must be held.
+func (c *PreparedStatementCache) rebuildOrder() {
+	order := c.order[:0]
+	for _, h := range c.order {
+		if _, ok := c.byKey[h]; ok {
+			order = append(order, h)
+		}
+	}
+	c.order = order
+}
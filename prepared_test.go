@@ -0,0 +1,35 @@
+package jepl_test
+
+import (
+	"testing"
+
+	"github.com/chenyoufu/jepl"
+)
+
+// Ensure Prepare accepts both bound-parameter spellings ("?" and
+// ":name"); canonicalize's commutative reordering of the WHERE clause
+// means the two can come out in either order, so this checks for their
+// presence rather than a fixed index.
+func TestPrepare_Params(t *testing.T) {
+	ps, err := jepl.Prepare(`SELECT avg(cpu) FROM host WHERE a = ? AND b = :name`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ps.Params) != 2 {
+		t.Fatalf("expected 2 params, got %d: %v", len(ps.Params), ps.Params)
+	}
+
+	var gotPositional, gotNamed bool
+	for _, p := range ps.Params {
+		switch p.Name {
+		case "":
+			gotPositional = true
+		case "name":
+			gotNamed = true
+		}
+	}
+	if !gotPositional || !gotNamed {
+		t.Errorf("expected one positional and one named %q param, got %v", "name", ps.Params)
+	}
+}
@@ -0,0 +1,147 @@
+package jepl
+
+import "fmt"
+
+// Op is a Program instruction opcode.
+type Op int
+
+const (
+	// OpLoadConst pushes consts[arg] onto the stack.
+	OpLoadConst Op = iota
+	// OpLoadVar pushes valuer.Value(vars[arg]) onto the stack.
+	OpLoadVar
+	// OpFallback evaluates calls[arg] against valuer with the ordinary
+	// tree-walking EvalValuer and pushes the result, for subtrees (Call,
+	// ConditionalExpr) whose semantics aren't worth reimplementing as
+	// instructions.
+	OpFallback
+	// OpBinary pops rhs then lhs, applies ops[arg], and pushes the result.
+	OpBinary
+)
+
+// instr is one Program instruction: an opcode plus an index into the
+// Program slice OpLoadConst/OpLoadVar/OpFallback/OpBinary reads from.
+type instr struct {
+	op  Op
+	arg int
+}
+
+// Program is an expression compiled to a flat sequence of stack
+// instructions, so repeated evaluation against many Valuers skips
+// re-walking the AST each time. Run executes it; Compile builds one.
+type Program struct {
+	instrs []instr
+	consts []interface{}
+	vars   []string
+	calls  []Expr
+	ops    []Token
+}
+
+// compiler accumulates a Program while walking an expression tree once.
+type compiler struct {
+	prog *Program
+}
+
+// Compile flattens expr into a reusable Program. *Call, *ConditionalExpr,
+// *IndexExpr, *SliceExpr, and *CastExpr subtrees compile to a single
+// OpFallback instruction that defers to EvalValuer at Run time, keeping
+// EvalValuer's semantics (a Call resolved through the Valuer, e.g.
+// "now()", with no Aggregator dispatch; short-circuit evaluation of a
+// ConditionalExpr) rather than reimplementing them as instructions.
+// Constant subexpressions (literals, and BinaryExprs built entirely from
+// them) fold to a single OpLoadConst at compile time.
+func Compile(expr Expr) (*Program, error) {
+	c := &compiler{prog: &Program{}}
+	if err := c.compile(expr); err != nil {
+		return nil, err
+	}
+	return c.prog, nil
+}
+
+func (c *compiler) compile(expr Expr) error {
+	if isConst(expr) {
+		c.emitConst(EvalValuer(expr, nil))
+		return nil
+	}
+
+	switch expr := expr.(type) {
+	case *ParenExpr:
+		return c.compile(expr.Expr)
+	case *BinaryExpr:
+		if err := c.compile(expr.LHS); err != nil {
+			return err
+		}
+		if err := c.compile(expr.RHS); err != nil {
+			return err
+		}
+		c.prog.ops = append(c.prog.ops, expr.Op)
+		c.prog.instrs = append(c.prog.instrs, instr{op: OpBinary, arg: len(c.prog.ops) - 1})
+		return nil
+	case *VarRef:
+		c.prog.vars = append(c.prog.vars, expr.Val)
+		c.prog.instrs = append(c.prog.instrs, instr{op: OpLoadVar, arg: len(c.prog.vars) - 1})
+		return nil
+	case *Call, *ConditionalExpr, *IndexExpr, *SliceExpr, *CastExpr:
+		c.prog.calls = append(c.prog.calls, expr)
+		c.prog.instrs = append(c.prog.instrs, instr{op: OpFallback, arg: len(c.prog.calls) - 1})
+		return nil
+	default:
+		return fmt.Errorf("jepl: Compile: unsupported expression %T", expr)
+	}
+}
+
+func (c *compiler) emitConst(v interface{}) {
+	c.prog.consts = append(c.prog.consts, v)
+	c.prog.instrs = append(c.prog.instrs, instr{op: OpLoadConst, arg: len(c.prog.consts) - 1})
+}
+
+// isConst reports whether expr can be evaluated once at compile time
+// because it never reads a VarRef: literals, a ParenExpr around one, or
+// a BinaryExpr built entirely from them.
+func isConst(expr Expr) bool {
+	switch expr := expr.(type) {
+	case *BooleanLiteral, *IntegerLiteral, *NumberLiteral, *RegexLiteral, *StringLiteral, *ListLiteral, *nilLiteral:
+		return true
+	case *ParenExpr:
+		return isConst(expr.Expr)
+	case *BinaryExpr:
+		return isConst(expr.LHS) && isConst(expr.RHS)
+	default:
+		return false
+	}
+}
+
+// Run executes the program against valuer, returning the top-of-stack
+// result. A malformed Program (stack underflow) is reported as an error
+// rather than a panic escaping to the caller.
+func (p *Program) Run(valuer Valuer) (result interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("jepl: Program.Run: %v", r)
+		}
+	}()
+
+	stack := make([]interface{}, 0, len(p.instrs))
+	for _, in := range p.instrs {
+		switch in.op {
+		case OpLoadConst:
+			stack = append(stack, p.consts[in.arg])
+		case OpLoadVar:
+			v, _ := valuer.Value(p.vars[in.arg])
+			stack = append(stack, v)
+		case OpFallback:
+			stack = append(stack, EvalValuer(p.calls[in.arg], valuer))
+		case OpBinary:
+			n := len(stack)
+			lhs, rhs := stack[n-2], stack[n-1]
+			stack = stack[:n-2]
+			stack = append(stack, applyBinaryOp(p.ops[in.arg], lhs, rhs))
+		default:
+			return nil, fmt.Errorf("jepl: Program.Run: unknown opcode %v", in.op)
+		}
+	}
+	if len(stack) != 1 {
+		return nil, fmt.Errorf("jepl: Program.Run: expected 1 result, got %d", len(stack))
+	}
+	return stack[0], nil
+}
@@ -0,0 +1,110 @@
+package jepl
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// PrometheusGroup holds the concrete GROUP BY label values for one bucket
+// alongside the Points aggregated for that bucket.
+type PrometheusGroup struct {
+	Labels map[string]string
+	Points Points
+}
+
+// EvalPrometheus groups docs by s.Dimensions the same way FlatStatByGroup
+// does, but keeps the concrete dimension values alongside each group's
+// aggregated metrics instead of folding them into an opaque BinaryExpr key.
+func (s *SelectStatement) EvalPrometheus(docs []string) map[string]*PrometheusGroup {
+	groups := make(map[string]*PrometheusGroup)
+	stmts := make(map[string]*SelectStatement)
+
+	for _, doc := range docs {
+		d := doc
+		res, ok := Eval(s.Condition, &d).(bool)
+		if !ok || !res {
+			continue
+		}
+
+		labels := make(map[string]string, len(s.Dimensions))
+		keyParts := make([]string, 0, len(s.Dimensions))
+		for _, dim := range s.Dimensions {
+			name := dim.Expr.String()
+			val := fmt.Sprintf("%v", Eval(dim.Expr, &d))
+			labels[name] = val
+			keyParts = append(keyParts, name+"="+val)
+		}
+		key := strings.Join(keyParts, ",")
+
+		st, ok := stmts[key]
+		if !ok {
+			st = s.Clone()
+			stmts[key] = st
+			groups[key] = &PrometheusGroup{Labels: labels}
+		}
+		st.EvalFunctionCalls(&d)
+	}
+
+	for key, st := range stmts {
+		groups[key].Points = st.evalMetric()
+	}
+	return groups
+}
+
+// promNameRe matches characters that are illegal in Prometheus metric and
+// label names.
+var promNameRe = regexp.MustCompile(`[^a-zA-Z0-9_:]`)
+
+func sanitizePromName(s string) string {
+	return promNameRe.ReplaceAllString(s, "_")
+}
+
+// ExportPrometheus renders EvalPrometheus's grouped results as the
+// Prometheus text exposition format: name is used as the metric family
+// prefix, each SELECT field/alias becomes "<name>_<alias>", and each
+// GROUP BY dimension becomes a label on the sample.
+func (s *SelectStatement) ExportPrometheus(name string, docs []string) []byte {
+	groups := s.EvalPrometheus(docs)
+
+	keys := make([]string, 0, len(groups))
+	for k := range groups {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	aliases := s.Fields.AliasNames()
+
+	var buf bytes.Buffer
+	typeEmitted := make(map[string]bool)
+	for _, key := range keys {
+		g := groups[key]
+
+		labelNames := make([]string, 0, len(g.Labels))
+		for n := range g.Labels {
+			labelNames = append(labelNames, n)
+		}
+		sort.Strings(labelNames)
+
+		labelPairs := make([]string, 0, len(labelNames))
+		for _, n := range labelNames {
+			labelPairs = append(labelPairs, fmt.Sprintf("%s=%q", sanitizePromName(n), g.Labels[n]))
+		}
+		labelStr := ""
+		if len(labelPairs) > 0 {
+			labelStr = "{" + strings.Join(labelPairs, ",") + "}"
+		}
+
+		for i, p := range g.Points {
+			metric := sanitizePromName(name + "_" + aliases[i])
+			if !typeEmitted[metric] {
+				fmt.Fprintf(&buf, "# TYPE %s gauge\n", metric)
+				typeEmitted[metric] = true
+			}
+			fmt.Fprintf(&buf, "%s%s %v %d\n", metric, labelStr, p.Metric, p.TS*1000)
+		}
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,72 @@
+package jepl
+
+import "strings"
+
+// QuoteIdent returns a quoted identifier from multiple bare or quoted
+// segments, joined together by periods. Segments that require quoting,
+// and every non-last, non-empty segment, are double-quoted.
+func QuoteIdent(segments ...string) string {
+	var buf strings.Builder
+	for i, segment := range segments {
+		needsQuote := (i < len(segments)-1 && segment != "") || IdentNeedsQuotes(segment)
+
+		if i > 0 {
+			buf.WriteString(".")
+		}
+
+		if needsQuote {
+			buf.WriteString(`"`)
+			buf.WriteString(strings.Replace(segment, `"`, `\"`, -1))
+			buf.WriteString(`"`)
+		} else {
+			buf.WriteString(segment)
+		}
+	}
+	return buf.String()
+}
+
+// IdentNeedsQuotes returns true if the identifier is a keyword or if it
+// contains any character that isn't valid in a bare identifier. A `.` is
+// allowed so a single segment holding a dotted field path (the common
+// VarRef case) prints bare.
+func IdentNeedsQuotes(ident string) bool {
+	if ident == "" {
+		return false
+	}
+	if tok := Lookup(ident); tok != IDENT {
+		return true
+	}
+	for i, ch := range ident {
+		if i == 0 {
+			if !isIdentFirstChar(ch) {
+				return true
+			}
+			continue
+		}
+		if !isIdentChar(ch) && ch != '.' {
+			return true
+		}
+	}
+	return false
+}
+
+// QuoteString returns a quoted string literal, escaping embedded
+// backslashes, single quotes and newlines.
+func QuoteString(s string) string {
+	var buf strings.Builder
+	buf.WriteString(`'`)
+	for _, ch := range s {
+		switch ch {
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\'':
+			buf.WriteString(`\'`)
+		default:
+			buf.WriteRune(ch)
+		}
+	}
+	buf.WriteString(`'`)
+	return buf.String()
+}
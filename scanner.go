@@ -0,0 +1,472 @@
+package jepl
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+)
+
+// eof represents a marker rune for the end of the reader.
+const eof = rune(0)
+
+// errBadString is returned by ScanString when the string is not terminated
+// by a matching quote, or contains a literal newline before the closing quote.
+var errBadString = errors.New("bad string")
+
+// errBadEscape is returned by ScanString when a `\` is followed by a rune
+// that is not a recognized escape sequence.
+var errBadEscape = errors.New("bad escape")
+
+// bufRune is a rune read from the underlying reader along with the
+// position it was read at.
+type bufRune struct {
+	ch  rune
+	pos Pos
+}
+
+// reader wraps a bufio.Reader and tracks the line/char position of every
+// rune it returns. Runes already read are kept in a small trailing log so
+// the scanner can unread several levels deep (needed to disambiguate a
+// leading sign/decimal point from a number literal).
+type reader struct {
+	r   *bufio.Reader
+	pos Pos // position of the next fresh rune to pull from r
+	log []bufRune
+	idx int
+}
+
+// ReadRune implements io.RuneScanner.
+func (rd *reader) ReadRune() (ch rune, size int, err error) {
+	if rd.idx < len(rd.log) {
+		br := rd.log[rd.idx]
+		rd.idx++
+		return br.ch, 1, nil
+	}
+
+	ch, size, err = rd.r.ReadRune()
+	if err != nil {
+		ch, size, err = eof, 0, nil
+	}
+
+	pos := rd.pos
+	if ch == '\n' {
+		rd.pos.Line++
+		rd.pos.Char = 0
+	} else {
+		rd.pos.Char++
+	}
+
+	rd.log = append(rd.log, bufRune{ch: ch, pos: pos})
+	rd.idx++
+
+	// Trim the log occasionally; the scanner never unreads more than a
+	// couple of runes (sign, decimal point, and a digit of lookahead).
+	if rd.idx > 8 {
+		rd.log = rd.log[rd.idx-8:]
+		rd.idx = 8
+	}
+
+	return ch, size, err
+}
+
+// UnreadRune implements io.RuneScanner.
+func (rd *reader) UnreadRune() error {
+	if rd.idx == 0 {
+		return errors.New("jepl: UnreadRune: nothing to unread")
+	}
+	rd.idx--
+	return nil
+}
+
+// lastPos returns the position of the most recently returned rune.
+func (rd *reader) lastPos() Pos {
+	if rd.idx == 0 {
+		return Pos{}
+	}
+	return rd.log[rd.idx-1].pos
+}
+
+// Scanner represents a lexical scanner for jepl source text.
+type Scanner struct {
+	r *reader
+}
+
+// NewScanner returns a new instance of Scanner.
+func NewScanner(r io.Reader) *Scanner {
+	return &Scanner{r: &reader{r: bufio.NewReader(r)}}
+}
+
+// Scan returns the next token, its position, and its literal text.
+func (s *Scanner) Scan() (tok Token, pos Pos, lit string) {
+	ch, pos := s.read()
+
+	if isWhitespace(ch) {
+		s.unread()
+		return s.scanWhitespace()
+	} else if isLetter(ch) || ch == '_' {
+		s.unread()
+		return s.scanIdent()
+	} else if isDigit(ch) {
+		s.unread()
+		return s.scanNumber()
+	} else if ch == '"' || ch == '\'' {
+		s.unread()
+		return s.scanString()
+	}
+
+	switch ch {
+	case eof:
+		return EOF, pos, ""
+	case '.':
+		ch1, _ := s.read()
+		s.unread()
+		if isDigit(ch1) {
+			s.unread()
+			return s.scanNumber()
+		}
+		return DOT, pos, ""
+	case '+', '-':
+		return s.scanSignedNumberOrOperator(ch, pos)
+	case '(':
+		return LPAREN, pos, ""
+	case ')':
+		return RPAREN, pos, ""
+	case '[':
+		return LBRACKET, pos, ""
+	case ']':
+		return RBRACKET, pos, ""
+	case ',':
+		return COMMA, pos, ""
+	case ':':
+		ch1, _ := s.read()
+		if ch1 == ':' {
+			return DOUBLECOLON, pos, ""
+		} else if isIdentFirstChar(ch1) {
+			// A ":name" bound-parameter placeholder (see paramName in
+			// prepared.go) scans as an IDENT whose literal includes the
+			// leading colon, so the parser's ordinary VarRef path picks
+			// it up without any dedicated grammar of its own. The name
+			// is read directly (not via scanIdent) so a param named
+			// after a keyword, e.g. ":from", isn't collapsed to an
+			// empty literal by the keyword lookup.
+			var buf bytes.Buffer
+			buf.WriteRune(ch1)
+			for {
+				ch2, _ := s.read()
+				if ch2 == eof || !isIdentChar(ch2) {
+					s.unread()
+					break
+				}
+				buf.WriteRune(ch2)
+			}
+			return IDENT, pos, ":" + buf.String()
+		}
+		s.unread()
+		return COLON, pos, ""
+	case '?':
+		// A "?" positional bound-parameter placeholder; see the ':name'
+		// case above.
+		return IDENT, pos, "?"
+	case ';':
+		return SEMICOLON, pos, ""
+	case '*':
+		return MUL, pos, ""
+	case '/':
+		return DIV, pos, ""
+	case '%':
+		return MOD, pos, ""
+	case '=':
+		if ch1, _ := s.read(); ch1 == '~' {
+			return EQREGEX, pos, ""
+		}
+		s.unread()
+		return EQ, pos, ""
+	case '!':
+		if ch1, _ := s.read(); ch1 == '=' {
+			return NEQ, pos, ""
+		} else if ch1 == '~' {
+			return NEQREGEX, pos, ""
+		}
+		s.unread()
+		return ILLEGAL, pos, "!"
+	case '<':
+		if ch1, _ := s.read(); ch1 == '=' {
+			return LTE, pos, ""
+		}
+		s.unread()
+		return LT, pos, ""
+	case '>':
+		if ch1, _ := s.read(); ch1 == '=' {
+			return GTE, pos, ""
+		}
+		s.unread()
+		return GT, pos, ""
+	}
+
+	return ILLEGAL, pos, string(ch)
+}
+
+// scanSignedNumberOrOperator decides whether a leading `+`/`-` starts a
+// signed number literal or is a plain arithmetic operator, based on
+// whether a digit (possibly through a decimal point) immediately follows.
+func (s *Scanner) scanSignedNumberOrOperator(sign rune, pos Pos) (Token, Pos, string) {
+	ch1, _ := s.read()
+	if isDigit(ch1) {
+		s.unread() // ch1
+		s.unread() // sign
+		return s.scanNumber()
+	} else if ch1 == '.' {
+		ch2, _ := s.read()
+		s.unread() // ch2
+		if isDigit(ch2) {
+			s.unread() // '.'
+			s.unread() // sign
+			return s.scanNumber()
+		}
+		s.unread() // '.'
+		if sign == '+' {
+			return ADD, pos, ""
+		}
+		return SUB, pos, ""
+	}
+	s.unread() // ch1
+	if sign == '+' {
+		return ADD, pos, ""
+	}
+	return SUB, pos, ""
+}
+
+// scanWhitespace consumes all contiguous whitespace, normalizing any `\r`
+// (or `\r\n` pair) into a single `\n`.
+func (s *Scanner) scanWhitespace() (tok Token, pos Pos, lit string) {
+	var buf bytes.Buffer
+
+	ch, pos := s.read()
+	buf.WriteRune(s.normalizeWS(ch))
+
+	for {
+		ch, _ := s.read()
+		if ch == eof {
+			break
+		} else if !isWhitespace(ch) {
+			s.unread()
+			break
+		}
+		buf.WriteRune(s.normalizeWS(ch))
+	}
+
+	return WS, pos, buf.String()
+}
+
+// normalizeWS collapses a `\r`, consuming a following `\n` if present, into
+// a single `\n` in the output.
+func (s *Scanner) normalizeWS(ch rune) rune {
+	if ch != '\r' {
+		return ch
+	}
+	if ch1, _ := s.read(); ch1 != '\n' && ch1 != eof {
+		s.unread()
+	}
+	return '\n'
+}
+
+// scanIdent consumes a contiguous run of identifier characters, then
+// checks the literal against the keyword table.
+func (s *Scanner) scanIdent() (tok Token, pos Pos, lit string) {
+	var buf bytes.Buffer
+
+	ch, pos := s.read()
+	buf.WriteRune(ch)
+
+	for {
+		ch, _ := s.read()
+		if ch == eof {
+			break
+		} else if !isIdentChar(ch) {
+			s.unread()
+			break
+		}
+		buf.WriteRune(ch)
+	}
+
+	// A bareword glued directly onto a quote, with no separator, is not
+	// a valid identifier followed by a string: it's a missing opening
+	// quote. Report it the same way an actually-unterminated string
+	// would be.
+	endPos := s.r.lastPos()
+	if ch, _ := s.read(); ch == '"' || ch == '\'' {
+		return BADSTRING, endPos, ""
+	} else {
+		s.unread()
+	}
+
+	lit = buf.String()
+	if tok = Lookup(lit); tok != IDENT {
+		return tok, pos, ""
+	}
+	return IDENT, pos, lit
+}
+
+// scanNumber consumes a (possibly signed, possibly fractional) numeric
+// literal. The result is an INTEGER if no decimal point is present, and a
+// NUMBER otherwise.
+func (s *Scanner) scanNumber() (tok Token, pos Pos, lit string) {
+	var buf bytes.Buffer
+
+	ch, pos := s.read()
+	if ch == '+' || ch == '-' {
+		buf.WriteRune(ch)
+		ch, _ = s.read()
+	}
+
+	isFloat := false
+	for isDigit(ch) {
+		buf.WriteRune(ch)
+		ch, _ = s.read()
+	}
+
+	if ch == '.' {
+		ch1, _ := s.read()
+		isFloat = true
+		if isDigit(ch1) {
+			buf.WriteRune('.')
+			for isDigit(ch1) {
+				buf.WriteRune(ch1)
+				ch1, _ = s.read()
+			}
+		}
+		// A trailing dot with no following digits (e.g. `-100.`) is
+		// still a float; the dot itself is consumed either way, so ch1
+		// (not the dot) is what's left over for the next Scan call.
+		ch = ch1
+	}
+
+	if ch != eof {
+		s.unread()
+	}
+
+	if isFloat {
+		return NUMBER, pos, buf.String()
+	}
+	return INTEGER, pos, buf.String()
+}
+
+// scanString consumes a single- or double-quoted string literal.
+func (s *Scanner) scanString() (tok Token, pos Pos, lit string) {
+	pos = s.r.lastPos()
+
+	lit, err := ScanString(s.r)
+	if err == errBadEscape {
+		return BADESCAPE, s.r.lastPos(), lit
+	} else if err == errBadString {
+		return BADSTRING, pos, lit
+	}
+	return STRING, pos, lit
+}
+
+// ScanString reads a quoted string from r, where the opening rune (either
+// `'` or `"`) determines the closing delimiter. It handles the `\n`, `\\`
+// and matching-quote escape sequences.
+func ScanString(r io.RuneScanner) (string, error) {
+	ending, _, err := r.ReadRune()
+	if err != nil {
+		return "", errBadString
+	}
+
+	var buf bytes.Buffer
+	for {
+		ch0, _, err := r.ReadRune()
+		if ch0 == ending {
+			return buf.String(), nil
+		} else if err != nil || ch0 == eof || ch0 == '\n' {
+			return buf.String(), errBadString
+		} else if ch0 == '\\' {
+			ch1, _, err := r.ReadRune()
+			if err != nil || ch1 == eof {
+				return buf.String(), errBadString
+			}
+
+			switch ch1 {
+			case 'n':
+				buf.WriteRune('\n')
+			case '\\':
+				buf.WriteRune('\\')
+			default:
+				if ch1 == ending {
+					buf.WriteRune(ending)
+				} else {
+					return string(ch0) + string(ch1), errBadEscape
+				}
+			}
+		} else {
+			buf.WriteRune(ch0)
+		}
+	}
+}
+
+// ScanRegex consumes a regex literal delimited by `/`. Within the literal,
+// `\/` is unescaped to a literal `/`; any other backslash sequence is left
+// untouched so doubled backslashes are handled correctly.
+func (s *Scanner) ScanRegex() (tok Token, pos Pos, lit string) {
+	_, pos = s.read()
+
+	var buf bytes.Buffer
+	for {
+		ch, _ := s.read()
+		if ch == eof {
+			return BADREGEX, pos, buf.String()
+		} else if ch == '/' {
+			return REGEX, pos, buf.String()
+		} else if ch == '\\' {
+			ch1, _ := s.read()
+			if ch1 == '/' {
+				buf.WriteRune('/')
+			} else {
+				buf.WriteRune(ch)
+				if ch1 == eof {
+					s.unread()
+				} else {
+					buf.WriteRune(ch1)
+				}
+			}
+		} else {
+			buf.WriteRune(ch)
+		}
+	}
+}
+
+// skipWhitespace consumes runes up to (but not including) the next
+// non-whitespace rune, used just before ScanRegex since a regex literal
+// may follow its operator with intervening spaces.
+func (s *Scanner) skipWhitespace() {
+	for {
+		ch, _ := s.read()
+		if ch == eof {
+			return
+		} else if !isWhitespace(ch) {
+			s.unread()
+			return
+		}
+	}
+}
+
+// read reads the next rune from the underlying reader along with its
+// position.
+func (s *Scanner) read() (ch rune, pos Pos) {
+	ch, _, _ = s.r.ReadRune()
+	return ch, s.r.lastPos()
+}
+
+// unread pushes the last-read rune back onto the reader.
+func (s *Scanner) unread() { _ = s.r.UnreadRune() }
+
+func isWhitespace(ch rune) bool { return ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r' }
+
+func isLetter(ch rune) bool { return (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') }
+
+func isDigit(ch rune) bool { return ch >= '0' && ch <= '9' }
+
+func isIdentChar(ch rune) bool { return isLetter(ch) || isDigit(ch) || ch == '_' }
+
+func isIdentFirstChar(ch rune) bool { return isLetter(ch) || ch == '_' }
@@ -0,0 +1,80 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/chenyoufu/jepl"
+)
+
+// AlertManagerSink POSTs a rule's HAVING-surviving groups to
+// AlertManager's v2 API (POST /api/v2/alerts) as firing alerts.
+type AlertManagerSink struct {
+	URL    string
+	Client *http.Client
+	// Labels are merged onto every alert this sink sends, e.g.
+	// {"severity": "page", "team": "infra"}.
+	Labels map[string]string
+}
+
+// NewAlertManagerSink returns an AlertManagerSink posting to url (the
+// AlertManager base URL, e.g. "http://alertmanager:9093"), using
+// http.DefaultClient.
+func NewAlertManagerSink(url string) *AlertManagerSink {
+	return &AlertManagerSink{URL: url, Client: http.DefaultClient}
+}
+
+type alertManagerAlert struct {
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+	StartsAt    time.Time         `json:"startsAt"`
+}
+
+// Push sends one firing alert for groupKey, labeled by sqlID and
+// groupKey, with each SELECT field's value as an annotation.
+func (s *AlertManagerSink) Push(ctx context.Context, sqlID string, groupKey string, pts jepl.Points) error {
+	labels := make(map[string]string, len(s.Labels)+2)
+	for k, v := range s.Labels {
+		labels[k] = v
+	}
+	labels["alertname"] = sqlID
+	labels["group"] = groupKey
+
+	annotations := make(map[string]string, len(pts))
+	for i, p := range pts {
+		annotations[fmt.Sprintf("value_%d", i)] = fmt.Sprintf("%v", p.Metric)
+	}
+
+	body, err := json.Marshal([]alertManagerAlert{{
+		Labels:      labels,
+		Annotations: annotations,
+		StartsAt:    time.Now(),
+	}})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL+"/api/v2/alerts", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("jepl/sink: alertmanager returned %s", resp.Status)
+	}
+	return nil
+}
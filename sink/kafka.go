@@ -0,0 +1,44 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/chenyoufu/jepl"
+)
+
+// Producer is the minimal publish operation KafkaSink needs from a
+// Kafka client. Callers plug in sarama, confluent-kafka-go, or kafka-go
+// by implementing it; this package doesn't depend on any of them
+// directly since none are vendored in this tree.
+type Producer interface {
+	Produce(topic string, key, value []byte) error
+}
+
+// KafkaSink publishes a rule's evaluated Points to topic as a JSON
+// record, keyed by "<sqlID>/<groupKey>" so a compacted topic keeps only
+// the latest result per rule/group.
+type KafkaSink struct {
+	Producer Producer
+	Topic    string
+}
+
+// NewKafkaSink returns a KafkaSink publishing through producer to topic.
+func NewKafkaSink(producer Producer, topic string) *KafkaSink {
+	return &KafkaSink{Producer: producer, Topic: topic}
+}
+
+type kafkaRecord struct {
+	SQLID    string      `json:"sql_id"`
+	GroupKey string      `json:"group_key"`
+	Points   jepl.Points `json:"points"`
+}
+
+// Push marshals a kafkaRecord for sqlID/groupKey/pts and publishes it.
+func (s *KafkaSink) Push(ctx context.Context, sqlID string, groupKey string, pts jepl.Points) error {
+	value, err := json.Marshal(kafkaRecord{SQLID: sqlID, GroupKey: groupKey, Points: pts})
+	if err != nil {
+		return err
+	}
+	return s.Producer.Produce(s.Topic, []byte(sqlID+"/"+groupKey), value)
+}
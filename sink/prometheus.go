@@ -0,0 +1,66 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/chenyoufu/jepl"
+)
+
+var promNameRe = regexp.MustCompile(`[^a-zA-Z0-9_:]`)
+
+func sanitizePromName(s string) string {
+	return promNameRe.ReplaceAllString(s, "_")
+}
+
+// PrometheusPushSink pushes a rule's evaluated Points to a Prometheus
+// Pushgateway as the text exposition format. It does not speak the real
+// remote-write wire protocol (snappy-compressed protobuf built from
+// prometheus/prompb.WriteRequest), since neither is vendored anywhere in
+// this tree; this reuses the text format SelectStatement.ExportPrometheus
+// already produces instead.
+type PrometheusPushSink struct {
+	URL     string
+	JobName string
+	Client  *http.Client
+}
+
+// NewPrometheusPushSink returns a PrometheusPushSink pushing to a
+// Pushgateway at url (e.g. "http://pushgateway:9091") under jobName.
+func NewPrometheusPushSink(url, jobName string) *PrometheusPushSink {
+	return &PrometheusPushSink{URL: url, JobName: jobName, Client: http.DefaultClient}
+}
+
+// Push renders pts as one gauge sample per SELECT field, labeled by
+// groupKey, and POSTs it to the Pushgateway's job endpoint.
+func (s *PrometheusPushSink) Push(ctx context.Context, sqlID string, groupKey string, pts jepl.Points) error {
+	var buf bytes.Buffer
+	metric := sanitizePromName(sqlID)
+	fmt.Fprintf(&buf, "# TYPE %s gauge\n", metric)
+	for i, p := range pts {
+		fmt.Fprintf(&buf, "%s{field=\"%d\",group=%q} %v %d\n", metric, i, groupKey, p.Metric, p.TS*1000)
+	}
+
+	url := fmt.Sprintf("%s/metrics/job/%s", s.URL, s.JobName)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, &buf)
+	if err != nil {
+		return err
+	}
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("jepl/sink: pushgateway returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+// Package sink pushes evaluated JEPL query results to downstream alerting
+// and metrics systems. An Engine owns a set of compiled rules and, on
+// every Ingest, evaluates each rule's groups and dispatches the ones
+// that pass HAVING to every Sink configured for that rule — the
+// "SELECT ... GROUP BY ... HAVING ..." alerting use case described in
+// the rule's own docstring.
+package sink
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/chenyoufu/jepl"
+)
+
+// Sink is a downstream destination for one rule's evaluated groups.
+// Push is called once per surviving GROUP BY bucket; groupKey is the
+// same opaque key FlatStatByGroup/Evaluator produce (tag values joined
+// by "\x1f"), and pts is that bucket's evaluated SELECT fields.
+type Sink interface {
+	Push(ctx context.Context, sqlID string, groupKey string, pts jepl.Points) error
+}
+
+// Rule binds a compiled SELECT statement to the id it's reported under
+// and the Sinks its surviving groups are pushed to.
+type Rule struct {
+	ID    string
+	Stmt  *jepl.SelectStatement
+	Sinks []Sink
+}
+
+// Engine owns a set of Rules and evaluates every one of them against
+// each batch of documents handed to Ingest, the same way EvalSQL
+// evaluates one ad-hoc query.
+type Engine struct {
+	mu    sync.RWMutex
+	rules map[string]*Rule
+}
+
+// NewEngine returns an empty Engine.
+func NewEngine() *Engine {
+	return &Engine{rules: make(map[string]*Rule)}
+}
+
+// AddRule registers rule, replacing any existing rule with the same ID.
+func (e *Engine) AddRule(rule *Rule) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.rules[rule.ID] = rule
+}
+
+// RemoveRule unregisters the rule with the given ID, if any.
+func (e *Engine) RemoveRule(id string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.rules, id)
+}
+
+// Ingest evaluates every registered rule against docs and pushes each
+// rule's HAVING-surviving groups to its Sinks. Errors from individual
+// sinks are collected and returned together rather than aborting the
+// other rules/sinks, since one sink being down shouldn't stop delivery
+// to the others.
+func (e *Engine) Ingest(ctx context.Context, docs []string) error {
+	e.mu.RLock()
+	rules := make([]*Rule, 0, len(e.rules))
+	for _, r := range e.rules {
+		rules = append(rules, r)
+	}
+	e.mu.RUnlock()
+
+	// Sort for deterministic dispatch order; map iteration above isn't.
+	sort.Slice(rules, func(i, j int) bool { return rules[i].ID < rules[j].ID })
+
+	var errs []error
+	for _, rule := range rules {
+		if err := e.ingestRule(ctx, rule, docs); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("jepl/sink: %d rule(s) failed: %v", len(errs), errs)
+	}
+	return nil
+}
+
+func (e *Engine) ingestRule(ctx context.Context, rule *Rule, docs []string) error {
+	groups := rule.Stmt.FlatStatByGroup(docs)
+
+	var errs []error
+	for key, st := range groups {
+		pts := st.EvalMetric()
+		ok, err := st.EvalHaving(pts)
+		if err != nil || !ok {
+			continue
+		}
+		for _, s := range rule.Sinks {
+			if err := s.Push(ctx, rule.ID, key, pts); err != nil {
+				errs = append(errs, fmt.Errorf("rule %s: %w", rule.ID, err))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%v", errs)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package jepl
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// SubQuery is a nested SELECT used as a FROM source, e.g.
+// FROM (SELECT avg(cpu) AS c FROM host WHERE ...) AS q, exposing its
+// aliased fields to the outer query as "<alias>.<fieldAlias>".
+type SubQuery struct {
+	Statement *SelectStatement
+	Alias     string
+}
+
+// String returns a string representation of the subquery source.
+func (s *SubQuery) String() string {
+	return fmt.Sprintf("(%s) AS %s", s.Statement.String(), QuoteIdent(s.Alias))
+}
+
+// EvalSubquery runs the subquery against docs and projects its
+// aggregated result onto the keys "<alias>.<fieldAlias>", so the outer
+// query can reference them with ordinary VarRefs.
+func (s *SubQuery) EvalSubquery(docs []string) map[string]interface{} {
+	for _, doc := range docs {
+		d := doc
+		if res, ok := Eval(s.Statement.Condition, &d).(bool); ok && res {
+			s.Statement.EvalFunctionCalls(&d)
+		}
+	}
+	points := s.Statement.evalMetric()
+
+	aliases := s.Statement.Fields.AliasNames()
+	out := make(map[string]interface{}, len(points))
+	for i, p := range points {
+		if i < len(aliases) {
+			out[s.Alias+"."+aliases[i]] = p.Metric
+		}
+	}
+	return out
+}
+
+// ResolveSubqueries runs every *SubQuery in s.Sources against docs and
+// merges their projected fields into each outer doc, so the outer
+// WHERE/SELECT can reference a subquery's aliased field like "q.c"
+// the same way it references any other JSON field.
+func (s *SelectStatement) ResolveSubqueries(docs []string) ([]string, error) {
+	var projected map[string]interface{}
+	for _, src := range s.Sources {
+		sq, ok := src.(*SubQuery)
+		if !ok {
+			continue
+		}
+		if projected == nil {
+			projected = make(map[string]interface{})
+		}
+		for k, v := range sq.EvalSubquery(docs) {
+			projected[k] = v
+		}
+	}
+	if projected == nil {
+		return docs, nil
+	}
+
+	out := make([]string, 0, len(docs))
+	for _, doc := range docs {
+		m := make(map[string]interface{})
+		if err := json.Unmarshal([]byte(doc), &m); err != nil {
+			return nil, err
+		}
+		for k, v := range projected {
+			m[k] = v
+		}
+		b, err := json.Marshal(m)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, string(b))
+	}
+	return out, nil
+}
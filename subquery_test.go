@@ -0,0 +1,21 @@
+package jepl_test
+
+import (
+	"testing"
+
+	"github.com/chenyoufu/jepl"
+)
+
+// Ensure SubQuery.String() quotes its alias the same way any other
+// identifier-bearing node does.
+func TestSubQuery_String(t *testing.T) {
+	sq := &jepl.SubQuery{
+		Statement: MustParseSelectStatement(`SELECT avg(cpu) AS c FROM host`),
+		Alias:     `my query`,
+	}
+
+	exp := `(SELECT avg(cpu) AS c FROM host) AS "my query"`
+	if s := sq.String(); s != exp {
+		t.Errorf("SubQuery.String() mismatch:\nexp=%s\ngot=%s", exp, s)
+	}
+}
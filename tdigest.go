@@ -0,0 +1,95 @@
+package jepl
+
+import "sort"
+
+// tDigestCentroid is one compressed centroid in a tDigest: a running mean
+// and the number of samples folded into it.
+type tDigestCentroid struct {
+	mean   float64
+	weight float64
+}
+
+// tDigest is a streaming approximate-quantile sketch (Dunning's
+// t-digest): samples are folded into a small set of centroids, merging a
+// new sample into the nearest centroid that still has room under the
+// t-digest size-limit curve, so centroids near the median absorb the
+// most weight while centroids near the tails stay small and keep tail
+// quantiles accurate.
+type tDigest struct {
+	compression float64
+	centroids   []tDigestCentroid
+	count       float64
+}
+
+// newTDigest returns a tDigest with the given compression factor; a
+// higher compression keeps more, smaller centroids and yields better
+// accuracy at higher memory cost.
+func newTDigest(compression float64) *tDigest {
+	if compression <= 0 {
+		compression = 100
+	}
+	return &tDigest{compression: compression}
+}
+
+// Add folds v into the digest.
+func (d *tDigest) Add(v float64) {
+	d.count++
+
+	best := -1
+	bestDist := 0.0
+	cum := 0.0
+	for i, c := range d.centroids {
+		q := (cum + c.weight/2) / d.count
+		limit := 4 * d.count * q * (1 - q) / d.compression
+		dist := absFloat(c.mean - v)
+		if c.weight < limit && (best == -1 || dist < bestDist) {
+			best, bestDist = i, dist
+		}
+		cum += c.weight
+	}
+
+	if best >= 0 {
+		c := &d.centroids[best]
+		c.mean += (v - c.mean) / (c.weight + 1)
+		c.weight++
+	} else {
+		d.centroids = append(d.centroids, tDigestCentroid{mean: v, weight: 1})
+	}
+
+	if len(d.centroids) > int(d.compression)*4 {
+		d.compress()
+	}
+}
+
+// compress re-sorts centroids by mean so Quantile can walk them in
+// order; the digest's compactness comes from Add's merge step rather
+// than from discarding centroids here.
+func (d *tDigest) compress() {
+	sort.Slice(d.centroids, func(i, j int) bool { return d.centroids[i].mean < d.centroids[j].mean })
+}
+
+// Quantile returns the approximate value at quantile q (0..1),
+// interpolating across cumulative centroid weights.
+func (d *tDigest) Quantile(q float64) float64 {
+	if len(d.centroids) == 0 {
+		return 0
+	}
+	d.compress()
+
+	target := q * d.count
+	cum := 0.0
+	for i, c := range d.centroids {
+		if cum+c.weight >= target || i == len(d.centroids)-1 {
+			return c.mean
+		}
+		cum += c.weight
+	}
+	return d.centroids[len(d.centroids)-1].mean
+}
+
+func absFloat(f float64) float64 {
+	if f < 0 {
+		return -f
+	}
+	return f
+}
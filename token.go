@@ -35,6 +35,7 @@ const (
 	SUB // -
 	MUL // *
 	DIV // /
+	MOD // %
 
 	AND // AND
 	OR  // OR
@@ -47,6 +48,7 @@ const (
 	LTE      // <=
 	GT       // >
 	GTE      // >=
+	CONTAINS // CONTAINS
 	operatorEnd
 
 	LBRACKET    // [
@@ -62,7 +64,9 @@ const (
 	keywordBeg
 	ALL
 	AS
+	BY
 	FROM
+	GROUP
 	NI // not in
 	IN
 	SELECT
@@ -89,6 +93,7 @@ var tokens = [...]string{
 	SUB: "-",
 	MUL: "*",
 	DIV: "/",
+	MOD: "%",
 
 	AND: "AND",
 	OR:  "OR",
@@ -101,6 +106,7 @@ var tokens = [...]string{
 	LTE:      "<=",
 	GT:       ">",
 	GTE:      ">=",
+	CONTAINS: "CONTAINS",
 
 	LBRACKET:    "[",
 	LPAREN:      "(",
@@ -114,7 +120,9 @@ var tokens = [...]string{
 
 	ALL:    "ALL",
 	AS:     "AS",
+	BY:     "BY",
 	FROM:   "FROM",
+	GROUP:  "GROUP",
 	NI:     "NI",
 	IN:     "IN",
 	SELECT: "SELECT",
@@ -128,7 +136,7 @@ func init() {
 	for tok := keywordBeg + 1; tok < keywordEnd; tok++ {
 		keywords[strings.ToLower(tokens[tok])] = tok
 	}
-	for _, tok := range []Token{AND, OR} {
+	for _, tok := range []Token{AND, OR, CONTAINS} {
 		keywords[strings.ToLower(tokens[tok])] = tok
 	}
 	keywords["true"] = TRUE
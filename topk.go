@@ -0,0 +1,70 @@
+package jepl
+
+import "sort"
+
+// topKCounter is one tracked key in a topKSketch, with the Space-Saving
+// error bound (the count the evicted key had when this key replaced it).
+type topKCounter struct {
+	key   string
+	count float64
+	err   float64
+}
+
+// topKSketch tracks the approximate top-k most frequent values seen
+// using the Space-Saving algorithm: up to k*10 counters are kept; once
+// full, an incoming unseen key replaces the counter with the smallest
+// count, inheriting that count (plus one) so the estimate never
+// undercounts.
+type topKSketch struct {
+	capacity int
+	counters map[string]*topKCounter
+}
+
+func newTopKSketch(k int) *topKSketch {
+	if k <= 0 {
+		k = 1
+	}
+	return &topKSketch{
+		capacity: k * 10,
+		counters: make(map[string]*topKCounter),
+	}
+}
+
+// Add records one occurrence of key.
+func (t *topKSketch) Add(key string) {
+	if c, ok := t.counters[key]; ok {
+		c.count++
+		return
+	}
+	if len(t.counters) < t.capacity {
+		t.counters[key] = &topKCounter{key: key, count: 1}
+		return
+	}
+
+	var min *topKCounter
+	for _, c := range t.counters {
+		if min == nil || c.count < min.count {
+			min = c
+		}
+	}
+	delete(t.counters, min.key)
+	t.counters[key] = &topKCounter{key: key, count: min.count + 1, err: min.count}
+}
+
+// Top returns up to k keys ordered by estimated count, descending.
+func (t *topKSketch) Top(k int) []string {
+	all := make([]*topKCounter, 0, len(t.counters))
+	for _, c := range t.counters {
+		all = append(all, c)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].count > all[j].count })
+
+	if k <= 0 || k > len(all) {
+		k = len(all)
+	}
+	out := make([]string, k)
+	for i := 0; i < k; i++ {
+		out[i] = all[i].key
+	}
+	return out
+}
@@ -0,0 +1,29 @@
+package jepl
+
+import "math"
+
+// welford computes a running mean and variance with Welford's online
+// algorithm, avoiding the numerical instability of a naive
+// sum-of-squares accumulator.
+type welford struct {
+	n    float64
+	mean float64
+	m2   float64
+}
+
+// Add folds x into the running mean/variance.
+func (w *welford) Add(x float64) {
+	w.n++
+	delta := x - w.mean
+	w.mean += delta / w.n
+	w.m2 += delta * (x - w.mean)
+}
+
+// StdDev returns the sample standard deviation, or 0 if fewer than two
+// samples have been added.
+func (w *welford) StdDev() float64 {
+	if w.n < 2 {
+		return 0
+	}
+	return math.Sqrt(w.m2 / (w.n - 1))
+}
@@ -0,0 +1,255 @@
+package jepl
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// WindowSpec describes a GROUP BY time(size[, every]) clause: Size is the
+// window length, and Every is the slide interval. A tumbling window has
+// Every == Size (or unset); a sliding window has Every < Size.
+type WindowSpec struct {
+	Size  time.Duration
+	Every time.Duration
+}
+
+// WindowResult is one closed window's aggregated groups, emitted on
+// WindowedEvaluator.Windows().
+type WindowResult struct {
+	Start  time.Time
+	End    time.Time
+	Groups map[string]Metrics
+}
+
+// windowState is the per-window-start accumulator set for a
+// WindowedEvaluator.
+type windowState struct {
+	start, end time.Time
+	groups     map[string]*SelectStatement
+}
+
+// WindowedEvaluator extends Evaluator with GROUP BY time(...) bucketing:
+// each document is assigned to every window it overlaps based on
+// TimeField, and closed windows are emitted through Windows().
+type WindowedEvaluator struct {
+	*Evaluator
+
+	spec  WindowSpec
+	field Expr
+
+	mu              sync.Mutex
+	windows         map[int64]*windowState // keyed by window start, UnixNano
+	allowedLateness time.Duration
+	watermark       time.Time
+
+	out chan WindowResult
+}
+
+// NewWindowedEvaluator returns a WindowedEvaluator bucketing documents fed
+// to it into windows described by spec, using field (e.g. a VarRef for
+// "_source.@timestamp") to resolve each document's event time.
+func (s *SelectStatement) NewWindowedEvaluator(ctx context.Context, field Expr, spec WindowSpec) *WindowedEvaluator {
+	return &WindowedEvaluator{
+		Evaluator: s.NewEvaluator(ctx),
+		spec:      spec,
+		field:     field,
+		windows:   make(map[int64]*windowState),
+		out:       make(chan WindowResult, 16),
+	}
+}
+
+// NewGroupedWindowEvaluator builds a WindowedEvaluator from s's GROUP BY
+// time(...) dimension, using the remaining dimensions as tag keys and
+// timeField to resolve each document's event time. It errors if s has no
+// time(...) dimension.
+func (s *SelectStatement) NewGroupedWindowEvaluator(ctx context.Context, timeField Expr) (*WindowedEvaluator, error) {
+	dim, ok := s.WindowDimension()
+	if !ok {
+		return nil, fmt.Errorf("jepl: GROUP BY has no time(...) dimension")
+	}
+	spec, _ := dim.TimeWindow()
+	return s.NewWindowedEvaluator(ctx, timeField, spec), nil
+}
+
+// WithAllowedLateness keeps a window's accumulator alive for d past its
+// end before it is evicted, so out-of-order arrivals still land in the
+// right bucket.
+func (w *WindowedEvaluator) WithAllowedLateness(d time.Duration) *WindowedEvaluator {
+	w.allowedLateness = d
+	return w
+}
+
+// Windows returns the channel of closed windows. It is closed once Close
+// has flushed any remaining windows.
+func (w *WindowedEvaluator) Windows() <-chan WindowResult {
+	return w.out
+}
+
+// eventTime resolves the configurable timestamp field on doc.
+func (w *WindowedEvaluator) eventTime(doc *string) (time.Time, bool) {
+	switch v := Eval(w.field, doc).(type) {
+	case int64:
+		return time.Unix(0, v*int64(time.Millisecond)), true
+	case float64:
+		return time.Unix(0, int64(v)*int64(time.Millisecond)), true
+	case string:
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return time.Time{}, false
+		}
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// Feed assigns doc to every window it overlaps (more than one for sliding
+// windows), folds it into each window's per-group accumulator, then
+// evicts and emits any windows whose end plus allowed lateness has
+// passed the watermark.
+func (w *WindowedEvaluator) Feed(doc string) error {
+	select {
+	case <-w.ctx.Done():
+		return ErrEvaluatorClosed
+	default:
+	}
+
+	res, ok := Eval(w.stmt.Condition, &doc).(bool)
+	if !ok || !res {
+		return nil
+	}
+
+	ts, ok := w.eventTime(&doc)
+	if !ok {
+		return nil
+	}
+
+	key := w.groupKey(&doc)
+
+	w.mu.Lock()
+	if ts.After(w.watermark) {
+		w.watermark = ts
+	}
+	for _, start := range w.overlapping(ts) {
+		ws, ok := w.windows[start.UnixNano()]
+		if !ok {
+			ws = &windowState{
+				start:  start,
+				end:    start.Add(w.spec.Size),
+				groups: make(map[string]*SelectStatement),
+			}
+			w.windows[start.UnixNano()] = ws
+		}
+		st, ok := ws.groups[key]
+		if !ok {
+			st = w.stmt.Clone()
+			ws.groups[key] = st
+		}
+		st.EvalFunctionCalls(&doc)
+	}
+	w.evictLocked()
+	w.mu.Unlock()
+
+	return nil
+}
+
+// overlapping returns the start times of every window that ts falls
+// into: a single tumbling bucket, or every slide-aligned bucket a
+// sliding window's size spans.
+func (w *WindowedEvaluator) overlapping(ts time.Time) []time.Time {
+	every := w.spec.Every
+	if every <= 0 {
+		every = w.spec.Size
+	}
+
+	var starts []time.Time
+	tsNano := ts.UnixNano()
+	latest := (tsNano / int64(every)) * int64(every)
+	for start := latest; start > tsNano-int64(w.spec.Size); start -= int64(every) {
+		starts = append(starts, time.Unix(0, start))
+	}
+	return starts
+}
+
+// evictLocked closes and emits every window whose end plus allowed
+// lateness has passed the current watermark. w.mu must be held.
+func (w *WindowedEvaluator) evictLocked() {
+	for k, ws := range w.windows {
+		if w.watermark.Before(ws.end.Add(w.allowedLateness)) {
+			continue
+		}
+		groups := make(map[string]Metrics, len(ws.groups))
+		for gk, st := range ws.groups {
+			groups[gk] = Metrics{Points: st.evalMetric()}
+		}
+		w.out <- WindowResult{Start: ws.start, End: ws.end, Groups: groups}
+		delete(w.windows, k)
+	}
+}
+
+// Close flushes all remaining windows, closes Windows(), and releases the
+// underlying Evaluator.
+func (w *WindowedEvaluator) Close() error {
+	w.mu.Lock()
+	w.watermark = w.watermark.Add(w.allowedLateness + w.spec.Size)
+	w.evictLocked()
+	w.mu.Unlock()
+
+	close(w.out)
+	return w.Evaluator.Close()
+}
+
+// EvalSQLWindowed is EvalSQL's counterpart for a query whose GROUP BY has
+// a time(...) dimension: instead of collapsing docs to one Points per
+// group stamped with time.Now(), it buckets docs by timeField through a
+// WindowedEvaluator and returns one point per SELECT field per window per
+// group, ordered by window start time. Each bucket gets its own Call/Aggregator state
+// the same way FlatStatByGroup's groups do (WindowedEvaluator.Feed clones
+// s per group per window), so concurrent windows never share an
+// accumulator.
+func EvalSQLWindowed(sql string, docs []string, timeField Expr) (map[string]Points, error) {
+	stmt, err := ParseStatement(sql)
+	if err != nil {
+		return nil, err
+	}
+	selectStmt, ok := stmt.(*SelectStatement)
+	if !ok {
+		return nil, fmt.Errorf("jepl: EvalSQLWindowed only supports SELECT statements")
+	}
+
+	we, err := selectStmt.NewGroupedWindowEvaluator(context.Background(), timeField)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []WindowResult
+	done := make(chan struct{})
+	go func() {
+		for wr := range we.Windows() {
+			results = append(results, wr)
+		}
+		close(done)
+	}()
+
+	for _, doc := range docs {
+		_ = we.Feed(doc)
+	}
+	if err := we.Close(); err != nil {
+		return nil, err
+	}
+	<-done
+
+	sort.Slice(results, func(i, j int) bool { return results[i].Start.Before(results[j].Start) })
+
+	pm := make(map[string]Points)
+	for _, wr := range results {
+		for key, metrics := range wr.Groups {
+			for _, p := range metrics.Points {
+				pm[key] = append(pm[key], point{Metric: p.Metric, TS: wr.Start.Unix()})
+			}
+		}
+	}
+	return pm, nil
+}
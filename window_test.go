@@ -0,0 +1,24 @@
+package jepl_test
+
+import (
+	"testing"
+
+	"github.com/chenyoufu/jepl"
+)
+
+// Ensure EvalSQLWindowed's ParseStatement(sql) entry point actually
+// parses the query instead of erroring on an undefined symbol.
+func TestEvalSQLWindowed(t *testing.T) {
+	docs := []string{
+		`{"cpu": 1, "ts": 0}`,
+		`{"cpu": 3, "ts": 0}`,
+	}
+
+	pm, err := jepl.EvalSQLWindowed(`SELECT avg(cpu) FROM host WHERE cpu > 0 GROUP BY time(1)`, docs, MustParseExpr("ts"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pm) == 0 {
+		t.Fatal("expected at least one group of points")
+	}
+}